@@ -23,15 +23,19 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"time"
 
 	"docs-generator/pkg/config"
 	crdutil "docs-generator/pkg/crd"
+	"docs-generator/pkg/failure"
 	"docs-generator/pkg/models"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -59,34 +63,85 @@ type pageData struct {
 	Title         string
 }
 
+// Provenance describes the source a page is generated from.
+type Provenance struct {
+	Source     string
+	SHA        string
+	Branch     string
+	Author     string
+	Tagger     string
+	TagMessage string
+	Time       time.Time
+	// Built is a short human readable summary, e.g. "built from <sha> on <date>".
+	Built string
+}
+
 type docData struct {
-	Page        pageData
-	Tag         string
-	At          string
-	Group       string
-	Version     string
-	Kind        string
+	Page               pageData
+	Tag                string
+	Provenance         Provenance
+	At                 string
+	Group              string
+	Version            string
+	Kind               string
+	Served             bool
+	Storage            bool
+	Deprecated         bool
+	DeprecationWarning string
+	// Metadata holds the scope, names, printer columns and subresources.
+	Metadata crdutil.Metadata
+	// SourceFile is the CRD as shipped by the repo, next to the page.
+	SourceFile string
+	// Versions are all documented versions of the CRD, including this one.
+	Versions []versionLink
+	// Examples are the valid example resources of this version.
+	Examples    []example
 	Description string
 	Schema      apiextensions.JSONSchemaProps
 }
 
+// example is an example resource from the repo.
+type example struct {
+	Name string
+	Path string
+	YAML string
+}
+
+// versionLink links a doc page to the page of a version of the same CRD.
+type versionLink struct {
+	Version    string
+	Served     bool
+	Storage    bool
+	Deprecated bool
+	Current    bool
+	// URL is relative to the page of the current version.
+	URL string
+}
+
 type orgData struct {
-	Page     pageData
-	Repo     string
-	Tag      string
-	At       string
-	Tags     []string
-	CRDs     map[string]models.RepoCRD
-	Total    int
-	JsonData string
+	Page       pageData
+	Repo       string
+	Tag        string
+	Provenance Provenance
+	At         string
+	Tags       []string
+	CRDs       map[string]models.RepoCRD
+	Total      int
+	JsonData   string
 }
 
 type homeRow struct {
-	Repo      string
-	RepoShort string
-	Group     string
-	Version   string
-	Kind      string
+	Repo       string
+	RepoShort  string
+	Group      string
+	Version    string
+	Kind       string
+	Storage    bool
+	Deprecated bool
+	// Coverage counts the described properties of the schema, Percent is
+	// their share.
+	Coverage crdutil.Coverage
+	Percent  float64
 }
 
 type homeData struct {
@@ -94,21 +149,56 @@ type homeData struct {
 	Tag              string
 	PlatformVersions []string
 	Rows             []homeRow
-	JsonData         string
+	// Coverage and Percent are the description coverage of all rows
+	// together.
+	Coverage crdutil.Coverage
+	Percent  float64
+	JsonData string
+}
+
+// coverageFile is the description coverage of a platform version, written
+// next to its home page.
+const coverageFile = "coverage.json"
+
+// coverageReport is the description coverage of a platform version, as
+// written to coverageFile.
+type coverageReport struct {
+	PlatformVersion string        `json:"platformVersion"`
+	Properties      int           `json:"properties"`
+	Described       int           `json:"described"`
+	Coverage        float64       `json:"coverage"`
+	CRDs            []coverageRow `json:"crds"`
+}
+
+type coverageRow struct {
+	Repo       string  `json:"repo"`
+	Group      string  `json:"group"`
+	Version    string  `json:"version"`
+	Kind       string  `json:"kind"`
+	Properties int     `json:"properties"`
+	Described  int     `json:"described"`
+	Coverage   float64 `json:"coverage"`
 }
 
 var page *render.Render
 
+// sourceFile is the name of the original CRD written next to each doc page.
+const sourceFile = "crd.yaml"
+
 func main() {
 	var dbFile string
 	var configFile string
 	var outDir string
 	var templateDir string
+	var strict bool
+	var minCoverage float64
 
 	flag.StringVar(&dbFile, "db", "", "Specify an SQLite3 database with the correct tables initialized")
 	flag.StringVar(&configFile, "config", "", "Specify a yaml config file containing the repos to index")
 	flag.StringVar(&outDir, "out", "", "Specify the directory where the site should be generated")
 	flag.StringVar(&templateDir, "template", "", "Specify where the template files are located")
+	flag.BoolVar(&strict, "strict", false, "Fail if any page could not be generated, with an exit code for the kind of failure")
+	flag.Float64Var(&minCoverage, "min-coverage", 0, "Fail if the description coverage of any CRD of a platform version is below this percentage")
 
 	flag.Parse()
 
@@ -118,18 +208,21 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if minCoverage < 0 || minCoverage > 100 {
+		fmt.Println("Error: min-coverage must be a percentage between 0 and 100.")
+		os.Exit(1)
+	}
 
 	// open database
 	db, err := sql.Open("sqlite3", dbFile)
 	if err != nil {
-		panic(err)
+		failure.Exit(failure.Database, err)
 	}
 
 	// create output directory
 	err = os.MkdirAll(outDir, 0755)
 	if err != nil {
-		log.Println("Error creating output directory:", err)
-		return
+		failure.Exit(failure.Render, fmt.Errorf("creating output directory: %w", err))
 	}
 
 	// initialize renderer
@@ -154,23 +247,59 @@ func main() {
 	var conf config.Config
 	err = conf.NewConfigFromFile(configFile)
 	if err != nil {
-		log.Fatalf("Error loading config: %s: %v", configFile, err)
-		panic(err)
+		failure.Exit(failure.Config, fmt.Errorf("loading config %s: %w", configFile, err))
+	}
+	if len(conf.PlatformVersions) == 0 {
+		failure.Exit(failure.Config, fmt.Errorf("no platformVersions in config %s", configFile))
 	}
 
+	// pages which fail are skipped, the failures are reported at the end
+	var failures failure.Collector
+
 	// generate landing page(s)
-	home(db, outDir, "", conf.PlatformVersions)
+	failures.Add(failure.Render, "home", home(db, outDir, "", conf.PlatformVersions))
 	for _, v := range conf.PlatformVersions {
-		home(db, outDir, v, conf.PlatformVersions)
+		failures.Add(failure.Render, "home "+v, home(db, outDir, v, conf.PlatformVersions))
+	}
+
+	// CRDs below the minimum coverage fail the run, strict or not
+	coverageFailed := false
+	if minCoverage > 0 {
+		for _, v := range conf.PlatformVersions {
+			rows, err := fetchHomeRows(db, v)
+			if err != nil {
+				failures.Add(failure.Database, "coverage "+v, err)
+				continue
+			}
+			for _, r := range rows {
+				if r.Percent < minCoverage {
+					failures.Add(failure.Coverage, fmt.Sprintf("%s %s/%s/%s (%s)", v, r.Group, r.Kind, r.Version, r.Repo),
+						fmt.Errorf("%.1f%% of %d properties described, below %.1f%%", r.Percent, r.Coverage.Properties, minCoverage))
+					coverageFailed = true
+				}
+			}
+		}
 	}
 
 	// generate doc pages for all repos and CRDs
-	for repo, tags := range conf.Repos {
-		org(db, outDir, repo, "")
+	// the tags are taken from the database, as tag patterns in the config are
+	// resolved while indexing
+	for repo := range conf.Repos {
+		tags, err := fetchTags(db, repo)
+		if err != nil {
+			failures.Add(failure.Database, repo, err)
+			continue
+		}
+		failures.Add(failure.Render, repo, org(db, outDir, repo, "", &failures))
 		for _, tag := range tags {
-			org(db, outDir, repo, tag)
+			failures.Add(failure.Render, repo+"@"+tag, org(db, outDir, repo, tag, &failures))
 		}
 	}
+
+	failures.Summary(os.Stdout)
+	if strict || coverageFailed {
+		os.Exit(failures.ExitCode())
+	}
 }
 
 func getPageData(title string, disableNavBar bool) pageData {
@@ -183,251 +312,344 @@ func getPageData(title string, disableNavBar bool) pageData {
 	}
 }
 
-func fetchHomeRows(db *sql.DB, version string) []homeRow {
-	c, err := db.Query("SELECT tags.repo, crds.\"group\", crds.version, crds.kind FROM crds JOIN tags ON crds.tag_id = tags.id WHERE tags.name = $1 ORDER BY crds.kind;", version)
+// writePage renders the named template into the index.html of dir.
+func writePage(dir string, name string, data interface{}) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	file, err := os.Create(fmt.Sprintf("%s/%s", dir, "index.html"))
 	if err != nil {
-		log.Printf("failed to get crds for %s: %v", version, err)
-		panic(err) // something went wrong, there should be CRDs
+		return fmt.Errorf("creating index.html: %w", err)
 	}
+	defer file.Close()
+	if err := page.HTML(file, http.StatusOK, name, data); err != nil {
+		return fmt.Errorf("%sTemplate.Execute(): %w", name, err)
+	}
+	log.Printf("successfully rendered %s template", name)
+	return nil
+}
+
+func fetchTags(db *sql.DB, repo string) ([]string, error) {
+	c, err := db.Query("SELECT name FROM tags WHERE LOWER(repo)=LOWER($1) ORDER BY ordering, time DESC;", repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags for %s: %w", repo, err)
+	}
+	defer c.Close()
+	tags := []string{}
+	for c.Next() {
+		var t string
+		if err := c.Scan(&t); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, c.Err()
+}
+
+func fetchProvenance(db *sql.DB, repo string, tag string) (Provenance, error) {
+	var p Provenance
+	r := db.QueryRow("SELECT source, sha, branch, author, tagger, tag_message, time FROM tags WHERE LOWER(repo)=LOWER($1) AND name=$2;", repo, tag)
+	if err := r.Scan(&p.Source, &p.SHA, &p.Branch, &p.Author, &p.Tagger, &p.TagMessage, &p.Time); err != nil {
+		return p, fmt.Errorf("failed to get provenance of %s@%s: %w", repo, tag, err)
+	}
+	p.Built = fmt.Sprintf("built from %s on %s", p.SHA, p.Time.UTC().Format("2006-01-02"))
+	return p, nil
+}
+
+func fetchHomeRows(db *sql.DB, version string) ([]homeRow, error) {
+	c, err := db.Query("SELECT tags.repo, crds.\"group\", crds.version, crds.kind, crds.storage, crds.deprecated, crds.properties, crds.described_properties FROM crds JOIN tags ON crds.tag_id = tags.id WHERE tags.name = $1 ORDER BY crds.kind;", version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crds for %s: %w", version, err)
+	}
+	defer c.Close()
 	rows := []homeRow{}
 	for c.Next() {
 		var r, g, v, k string
-		if err := c.Scan(&r, &g, &v, &k); err != nil {
-			log.Printf("newTemplate.Execute(): %v", err)
+		var storage, deprecated bool
+		var cov crdutil.Coverage
+		if err := c.Scan(&r, &g, &v, &k, &storage, &deprecated, &cov.Properties, &cov.Described); err != nil {
+			return nil, fmt.Errorf("failed to scan crd: %w", err)
 		}
 		rows = append(rows, homeRow{
-			Repo:    r,
-			Group:   g,
-			Version: v,
-			Kind:    k,
+			Repo:       r,
+			Group:      g,
+			Version:    v,
+			Kind:       k,
+			Storage:    storage,
+			Deprecated: deprecated,
+			Coverage:   cov,
+			Percent:    cov.Percent(),
 		})
 	}
-	if c.Err() != nil {
-		log.Printf("Error in Next: %s", err)
-		panic(err)
-	}
-	return rows
+	return rows, c.Err()
 }
 
-func home(db *sql.DB, outDir string, version string, versions []string) {
+func home(db *sql.DB, outDir string, version string, versions []string) error {
 	fullDir := outDir
 	if version != "" {
 		fullDir = fmt.Sprintf("%s/%s", outDir, version)
 	}
-	err := os.MkdirAll(fullDir, 0755)
-	if err != nil {
-		log.Println("Error creating output directory:", err)
-		return
-	}
-	// Open the file for writing
-	file, err := os.Create(fmt.Sprintf("%s/%s", fullDir, "index.html"))
-	if err != nil {
-		log.Printf("Error creating index.html: %v", err)
-		return
-	}
-	defer file.Close()
 
 	if version == "" {
 		version = versions[0]
 	}
 
+	rows, err := fetchHomeRows(db, version)
+	if err != nil {
+		return failure.Wrap(failure.Database, "home "+version, err)
+	}
+
+	var total crdutil.Coverage
+	for _, r := range rows {
+		total = total.Add(r.Coverage)
+	}
+	log.Printf("description coverage of %s: %.1f%% of %d properties", version, total.Percent(), total.Properties)
 	dataTmp := homeData{
 		Page:             getPageData("Doc", false),
 		Tag:              version,
 		PlatformVersions: versions,
-		Rows:             fetchHomeRows(db, version),
+		Rows:             rows,
+		Coverage:         total,
+		Percent:          total.Percent(),
 		JsonData:         "",
 	}
+	if err := writeCoverage(fullDir, version, rows, total); err != nil {
+		return err
+	}
 
 	jsonData, err := json.Marshal(dataTmp)
 	if err != nil {
-		fmt.Println("Error marshaling JSON:", err)
-		return
+		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
 
 	dataTmp.JsonData = string(jsonData)
 
-	if err := page.HTML(file, http.StatusOK, "home", dataTmp); err != nil {
-		log.Printf("homeTemplate.Execute(): %v", err)
-		return
-	}
-	log.Print("successfully rendered home page")
+	return writePage(fullDir, "home", dataTmp)
 }
 
-func org(db *sql.DB, outDir string, repo string, tag string) {
-	fullDir := fmt.Sprintf("%s/%s", outDir, repo)
-	if tag != "" {
-		fullDir = fmt.Sprintf("%s/%s/%s", outDir, repo, tag)
+// writeCoverage writes the description coverage of the CRDs of a platform
+// version to the coverageFile in dir.
+func writeCoverage(dir string, version string, rows []homeRow, total crdutil.Coverage) error {
+	report := coverageReport{
+		PlatformVersion: version,
+		Properties:      total.Properties,
+		Described:       total.Described,
+		Coverage:        total.Percent(),
+		CRDs:            []coverageRow{},
+	}
+	for _, r := range rows {
+		report.CRDs = append(report.CRDs, coverageRow{
+			Repo:       r.Repo,
+			Group:      r.Group,
+			Version:    r.Version,
+			Kind:       r.Kind,
+			Properties: r.Coverage.Properties,
+			Described:  r.Coverage.Described,
+			Coverage:   r.Percent,
+		})
 	}
-	err := os.MkdirAll(fullDir, 0755)
+	b, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
-		log.Println("Error creating output directory:", err)
-		return
+		return err
 	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	return os.WriteFile(fmt.Sprintf("%s/%s", dir, coverageFile), append(b, '\n'), 0644)
+}
 
-	// Open the file for writing
-	file, err := os.Create(fmt.Sprintf("%s/%s", fullDir, "index.html"))
-	if err != nil {
-		log.Printf("Error creating index.html: %v", err)
-		return
+// org renders the page of a repo at a tag, and the doc pages of its CRDs. The
+// failures of the doc pages are added to failures.
+func org(db *sql.DB, outDir string, repo string, tag string, failures *failure.Collector) error {
+	fullDir := fmt.Sprintf("%s/%s", outDir, repo)
+	if tag != "" {
+		fullDir = fmt.Sprintf("%s/%s/%s", outDir, repo, tag)
 	}
-	defer file.Close()
 
 	pageData := getPageData(repo, false)
 	var c *sql.Rows
+	var err error
 	if tag == "" {
-		c, err = db.Query("SELECT t.name, c.'group', c.version, c.kind FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY time DESC LIMIT 1);", repo)
+		c, err = db.Query("SELECT t.name, c.'group', c.version, c.kind, c.served, c.storage, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE LOWER(repo) = LOWER($1) ORDER BY ordering, time DESC LIMIT 1);", repo)
 	} else {
 		pageData.Title += fmt.Sprintf("@%s", tag)
-		c, err = db.Query("SELECT t.name, c.'group', c.version, c.kind FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", repo, tag)
+		c, err = db.Query("SELECT t.name, c.'group', c.version, c.kind, c.served, c.storage, c.deprecated FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2;", repo, tag)
 	}
 	if err != nil {
-		log.Printf("failed to get CRDs for %s : %v", repo, err)
-		panic(err)
+		return failure.Wrap(failure.Database, repo, fmt.Errorf("failed to get CRDs: %w", err))
 	}
+	defer c.Close()
 	repoCRDs := map[string]models.RepoCRD{}
 	foundTag := tag
 	for c.Next() {
 		var t, g, v, k string
-		if err := c.Scan(&t, &g, &v, &k); err != nil {
-			log.Printf("newTemplate.Execute(): %v", err)
+		var served, storage, deprecated bool
+		if err := c.Scan(&t, &g, &v, &k, &served, &storage, &deprecated); err != nil {
+			return failure.Wrap(failure.Database, repo, fmt.Errorf("failed to scan CRD: %w", err))
 		}
 		foundTag = t
 		repoCRDs[g+"/"+v+"/"+k] = models.RepoCRD{
-			Group:   g,
-			Version: v,
-			Kind:    k,
+			Group:      g,
+			Version:    v,
+			Kind:       k,
+			Served:     served,
+			Storage:    storage,
+			Deprecated: deprecated,
 		}
 		// TODO I'm not happy about calling this function here, I'd rather call it in a different loop in main
 		// but it works for now
-		doc(db, outDir, repo, tag, g, k, v)
+		failures.Add(failure.Render, fmt.Sprintf("%s@%s %s/%s/%s", repo, tag, g, k, v), doc(db, outDir, repo, tag, g, k, v))
 	}
-	if c.Err() != nil {
-		log.Printf("Error in Next: %s", err)
-		panic(err)
+	if err := c.Err(); err != nil {
+		return failure.Wrap(failure.Database, repo, err)
 	}
-	c, err = db.Query("SELECT name FROM tags WHERE LOWER(repo)=LOWER($1) ORDER BY time DESC;", repo)
+	tags, err := fetchTags(db, repo)
 	if err != nil {
-		log.Printf("failed to get tags for %s : %v", repo, err)
-		panic(err) // something went wrong, there should be tags
+		return failure.Wrap(failure.Database, repo, err)
 	}
-	tags := []string{}
 	tagExists := false
-	for c.Next() {
-		var t string
-		if err := c.Scan(&t); err != nil {
-			log.Printf("newTemplate.Execute(): %v", err)
-		}
-		if !tagExists && t == tag {
+	for _, t := range tags {
+		if t == tag {
 			tagExists = true
 		}
-		tags = append(tags, t)
 	}
 	if len(tags) == 0 {
-		panic("This shouldn't happen, there are no tags!")
+		return fmt.Errorf("there are no tags")
 	}
 	if !tagExists && tag != "" {
-		panic("This shouldn't happend, the tag doesn't exist!")
+		return fmt.Errorf("the tag doesn't exist")
 	}
 	if foundTag == "" {
 		foundTag = tags[0]
 	}
+	provenance, err := fetchProvenance(db, repo, foundTag)
+	if err != nil {
+		return failure.Wrap(failure.Database, repo, err)
+	}
 
 	orgDataTmp := orgData{
-		Page:     pageData,
-		Repo:     repo,
-		Tag:      foundTag,
-		Tags:     tags,
-		CRDs:     repoCRDs,
-		Total:    len(repoCRDs),
-		JsonData: "",
+		Page:       pageData,
+		Repo:       repo,
+		Tag:        foundTag,
+		Provenance: provenance,
+		Tags:       tags,
+		CRDs:       repoCRDs,
+		Total:      len(repoCRDs),
+		JsonData:   "",
 	}
 
 	jsonData, err := json.Marshal(orgDataTmp)
 	if err != nil {
-		fmt.Println("Error marshaling JSON:", err)
-		return
+		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
 
 	orgDataTmp.JsonData = string(jsonData)
 
-	if err := page.HTML(file, http.StatusOK, "org", orgDataTmp); err != nil {
-		log.Printf("orgTemplate.Execute(): %v", err)
-		return
-	}
-	log.Printf("successfully rendered org template")
+	return writePage(fullDir, "org", orgDataTmp)
 }
 
-func doc(db *sql.DB, outDir string, repo string, tag string, group string, kind string, version string) {
+func doc(db *sql.DB, outDir string, repo string, tag string, group string, kind string, version string) error {
 	fullDir := fmt.Sprintf("%s/%s/%s/%s/%s", outDir, tag, group, kind, version)
-	err := os.MkdirAll(fullDir, 0755)
-	if err != nil {
-		log.Println("Error creating output directory:", err)
-		return
-	}
-
-	// Open the file for writing
-	file, err := os.Create(fmt.Sprintf("%s/%s", fullDir, "index.html"))
-	if err != nil {
-		log.Printf("Error creating index.html: %v", err)
-		return
-	}
-	defer file.Close()
 
 	pageData := getPageData(fmt.Sprintf("%s.%s/%s", kind, group, version), false)
 	var c *sql.Row
 	if tag == "" {
-		c = db.QueryRow("SELECT t.name, c.data FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE repo = $1 ORDER BY time DESC LIMIT 1) AND c.\"group\"=$2 AND c.version=$3 AND c.kind=$4;", repo, group, version, kind)
+		c = db.QueryRow("SELECT t.id, t.name, c.data, c.source_yaml, c.served, c.storage, c.deprecated, c.deprecation_warning FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.id = (SELECT id FROM tags WHERE repo = $1 ORDER BY ordering, time DESC LIMIT 1) AND c.\"group\"=$2 AND c.version=$3 AND c.kind=$4;", repo, group, version, kind)
 	} else {
-		c = db.QueryRow("SELECT t.name, c.data FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2 AND c.'group'=$3 AND c.version=$4 AND c.kind=$5;", repo, tag, group, version, kind)
+		c = db.QueryRow("SELECT t.id, t.name, c.data, c.source_yaml, c.served, c.storage, c.deprecated, c.deprecation_warning FROM tags t INNER JOIN crds c ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2 AND c.'group'=$3 AND c.version=$4 AND c.kind=$5;", repo, tag, group, version, kind)
 	}
+	subject := fmt.Sprintf("%s@%s %s/%s/%s", repo, tag, group, kind, version)
+	var tagID int
 	foundTag := tag
-	var crdJSON string
-	if err := c.Scan(&foundTag, &crdJSON); err != nil {
-		log.Printf("failed to get CRDs for %s : %v", repo, err)
-		panic(err)
+	var crdJSON, sourceYAML string
+	data := docData{Group: group, Version: version, Kind: kind}
+	if err := c.Scan(&tagID, &foundTag, &crdJSON, &sourceYAML, &data.Served, &data.Storage, &data.Deprecated, &data.DeprecationWarning); err != nil {
+		return failure.Wrap(failure.Database, subject, fmt.Errorf("failed to get CRD: %w", err))
 	}
 	crd := &apiextensions.CustomResourceDefinition{}
-	err = json.Unmarshal([]byte(crdJSON), &crd)
+	err := json.Unmarshal([]byte(crdJSON), &crd)
 	if err != nil {
-		fmt.Println("Error unmarshalling JSON:", err)
-		return
-	}
-	var schema *apiextensions.CustomResourceValidation
-	schema = crd.Spec.Validation
-	if len(crd.Spec.Versions) > 1 {
-		for _, version := range crd.Spec.Versions {
-			if version.Storage {
-				if version.Schema != nil {
-					schema = version.Schema
-				}
-				break
-			}
-		}
+		return failure.Wrap(failure.Parse, subject, fmt.Errorf("error unmarshalling JSON: %w", err))
 	}
-
+	schema := crdutil.VersionSchema(crd, version)
 	if schema == nil || schema.OpenAPIV3Schema == nil {
-		log.Print("CRD schema is nil.")
-		return
+		return failure.Wrap(failure.Render, subject, errors.New("CRD schema is nil"))
 	}
 
-	gvk := crdutil.GetStoredGVK(crd)
-	if gvk == nil {
-		log.Print("CRD GVK is nil.")
-		return
+	provenance, err := fetchProvenance(db, repo, foundTag)
+	if err != nil {
+		return failure.Wrap(failure.Database, subject, err)
+	}
+	versions, err := fetchVersions(db, tagID, group, kind, version)
+	if err != nil {
+		return failure.Wrap(failure.Database, subject, err)
+	}
+	examples, err := fetchExamples(db, tagID, group, kind, version)
+	if err != nil {
+		return failure.Wrap(failure.Database, subject, err)
+	}
+
+	data.Page = pageData
+	data.Tag = foundTag
+	data.Provenance = provenance
+	data.Versions = versions
+	data.Examples = examples
+	data.Metadata = crdutil.VersionMetadata(crd, version)
+	data.Description = string(schema.OpenAPIV3Schema.Description)
+	data.Schema = *schema.OpenAPIV3Schema
+	if sourceYAML != "" {
+		data.SourceFile = sourceFile
+	}
+	if err := writePage(fullDir, "doc", data); err != nil {
+		return err
+	}
+	if sourceYAML != "" {
+		if err := os.WriteFile(fmt.Sprintf("%s/%s", fullDir, sourceFile), []byte(sourceYAML), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", sourceFile, err)
+		}
 	}
+	return nil
+}
 
-	if err := page.HTML(file, http.StatusOK, "doc", docData{
-		Page:        pageData,
-		Tag:         foundTag,
-		Group:       gvk.Group,
-		Version:     gvk.Version,
-		Kind:        gvk.Kind,
-		Description: string(schema.OpenAPIV3Schema.Description),
-		Schema:      *schema.OpenAPIV3Schema,
-	}); err != nil {
-		log.Printf("docTemplate.Execute(): %v", err)
-		return
+// fetchExamples returns the valid examples of a version of a CRD at a tag.
+func fetchExamples(db *sql.DB, tagID int, group string, kind string, version string) ([]example, error) {
+	c, err := db.Query("SELECT name, path, data FROM examples WHERE tag_id=$1 AND \"group\"=$2 AND kind=$3 AND version=$4 AND valid ORDER BY path, document;", tagID, group, kind, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get examples: %w", err)
 	}
-	log.Printf("successfully rendered doc template")
+	defer c.Close()
+	examples := []example{}
+	for c.Next() {
+		var e example
+		if err := c.Scan(&e.Name, &e.Path, &e.YAML); err != nil {
+			return nil, fmt.Errorf("failed to scan example: %w", err)
+		}
+		examples = append(examples, e)
+	}
+	return examples, c.Err()
+}
+
+// fetchVersions returns links to all documented versions of a CRD at a tag,
+// ordered by version priority.
+func fetchVersions(db *sql.DB, tagID int, group string, kind string, current string) ([]versionLink, error) {
+	c, err := db.Query("SELECT version, served, storage, deprecated FROM crds WHERE tag_id=$1 AND \"group\"=$2 AND kind=$3;", tagID, group, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions: %w", err)
+	}
+	defer c.Close()
+	versions := []versionLink{}
+	for c.Next() {
+		var v versionLink
+		if err := c.Scan(&v.Version, &v.Served, &v.Storage, &v.Deprecated); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		v.Current = v.Version == current
+		v.URL = fmt.Sprintf("../%s/", v.Version)
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return crdutil.VersionLess(versions[j].Version, versions[i].Version)
+	})
+	return versions, c.Err()
 }
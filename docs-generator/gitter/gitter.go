@@ -17,38 +17,137 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path"
-	"regexp"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"docs-generator/pkg/config"
 	"docs-generator/pkg/crd"
+	"docs-generator/pkg/crd/lint"
+	"docs-generator/pkg/database"
+	"docs-generator/pkg/discovery"
+	"docs-generator/pkg/failure"
+	"docs-generator/pkg/helm"
+	"docs-generator/pkg/kustomize"
+	"docs-generator/pkg/manifest"
 	"docs-generator/pkg/models"
+	"docs-generator/pkg/source"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	_ "github.com/mattn/go-sqlite3"
 	"gopkg.in/square/go-jose.v2/json"
 	yaml "gopkg.in/yaml.v3"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 const (
-	crdArgCount = 6
+	crdArgCount        = 21
+	diagnosticArgCount = 5
+	exampleArgCount    = 10
+	lintIssueArgCount  = 8
+	// lintIssueBatch is the number of lint issues inserted at once
+	lintIssueBatch = 1000
 )
 
+// job is a single tag of a repo to index.
+type job struct {
+	Repo      string
+	Source    source.Source
+	Tag       string
+	Selector  string
+	Ref       plumbing.ReferenceName
+	Branch    string
+	Ordering  int
+	Matcher   *discovery.Matcher
+	Examples  *discovery.Matcher
+	Helm      config.Helm
+	Kustomize config.Kustomize
+	// Modifiers are applied to each CRD, ModifierNames describe them.
+	Modifiers     []crd.Modifier
+	ModifierNames []string
+	// Linter checks the schema of each CRD version, issues at least as
+	// severe as LintFailOn fail the run.
+	Linter     *lint.Linter
+	LintFailOn lint.Severity
+	// IndexedSHA and IndexedModifiers are the commit and the modifiers
+	// (as JSON) the tag was indexed with by a previous run, if any.
+	IndexedSHA       string
+	IndexedModifiers string
+}
+
+// modifiersChanged returns true if the CRDs of the tag were stored with other
+// modifiers than the job applies. Tags without CRDs never changed.
+func (j job) modifiersChanged() bool {
+	if j.IndexedModifiers == "" {
+		return false
+	}
+	b, err := json.Marshal(j.ModifierNames)
+	return err != nil || string(b) != j.IndexedModifiers
+}
+
+// result is the outcome of indexing a job, ready to be written to the
+// database.
+type result struct {
+	job
+	SHA        string
+	Time       time.Time
+	Author     string
+	Tagger     string
+	TagMessage string
+	CRDs       map[string]models.RepoCRD
+	Examples   []models.Example
+	// Diagnostics are the problems found while indexing, e.g. skipped
+	// documents.
+	Diagnostics diagnostics
+	Skipped     bool
+	// Err is set if indexing failed, Kind is the kind of the failure.
+	Err  error
+	Kind failure.Kind
+}
+
+// diagnostics collects the problems found while indexing a tag.
+type diagnostics []models.Diagnostic
+
+// add logs a problem and records it.
+func (d *diagnostics) add(severity string, path string, document int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("%s: %s (document %d): %s", severity, path, document, msg)
+	*d = append(*d, models.Diagnostic{
+		Path:     path,
+		Document: document,
+		Severity: severity,
+		Message:  msg,
+	})
+}
+
 func main() {
 	// Define command-line flags
 	var dbFile string
 	var configFile string
+	var parallel int
+	var cacheDir string
+	var reportFile string
+	var strict bool
+	var lintReportFile string
+	var lintFormat string
 
 	flag.StringVar(&dbFile, "db", "", "Specify an SQLite3 database with the correct tables initialized")
 	flag.StringVar(&configFile, "config", "", "Specify a yaml config file containing the repos to index")
+	flag.IntVar(&parallel, "parallel", 1, "Specify how many tags are cloned and indexed concurrently")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Specify a directory to keep mirrors of the repos in, which are reused across runs")
+	flag.StringVar(&reportFile, "report", "", "Specify a JSON file to write a report of the indexed tags and their diagnostics to")
+	flag.BoolVar(&strict, "strict", false, "Fail if any tag or document could not be indexed, with an exit code for the kind of failure")
+	flag.StringVar(&lintReportFile, "lint-report", "", "Specify a file to write the lint issues of each CRD to")
+	flag.StringVar(&lintFormat, "lint-format", "text", "Specify the format of the lint report, text or json")
 
 	flag.Parse()
 
@@ -58,186 +157,971 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if parallel < 1 {
+		fmt.Println("Error: parallel must be at least 1.")
+		os.Exit(1)
+	}
+	if lintFormat != "text" && lintFormat != "json" {
+		fmt.Println("Error: lint-format must be text or json.")
+		os.Exit(1)
+	}
 
 	// open database
-	db, err := sql.Open("sqlite3", dbFile)
+	db, err := sql.Open("sqlite3", dbFile+"?_journal_mode=WAL")
 	if err != nil {
-		panic(err)
+		failure.Exit(failure.Database, err)
+	}
+	defer db.Close()
+	// all writes happen from a single goroutine, one connection is enough
+	db.SetMaxOpenConns(1)
+	if err := database.Migrate(db); err != nil {
+		failure.Exit(failure.Database, fmt.Errorf("migrating database %s: %w", dbFile, err))
 	}
 
 	// read config
 	var conf config.Config
 	err = conf.NewConfigFromFile(configFile)
 	if err != nil {
-		log.Fatalf("Error loading config: %s: %v", configFile, err)
-		panic(err)
+		failure.Exit(failure.Config, fmt.Errorf("loading config %s: %w", configFile, err))
 	}
 
-	// index repos
-	for repo, tags := range conf.Repos {
-		log.Printf("Indexing repo %s ...\n", repo)
-		for _, tag := range tags {
-			log.Printf("... at tag: %s ...\n", tag)
-			err = Index(db, repo, tag)
-			// Check for errors
+	indexed, err := indexedTags(db)
+	if err != nil {
+		failure.Exit(failure.Database, fmt.Errorf("reading indexed tags: %w", err))
+	}
+	var failures failure.Collector
+
+	// collect jobs in a stable order, so the database is the same no matter
+	// in which order the clones finish
+	repos := make([]string, 0, len(conf.Repos))
+	for repo := range conf.Repos {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	jobs := []job{}
+	// resolved are the tags of each repo whose tags could be listed
+	resolved := map[string][]string{}
+	for _, repo := range repos {
+		first := len(jobs)
+		var src source.Source = &source.Git{URL: conf.RepoURL(repo), CacheDir: cacheDir}
+		if p := conf.Repos[repo].Path; p != "" {
+			abs, err := filepath.Abs(p)
 			if err != nil {
-				fmt.Println("Error:", err)
+				failure.Exit(failure.Config, fmt.Errorf("path of %s: %w", repo, err))
+			}
+			src = &source.Local{Path: abs}
+		}
+		repoJob, err := newRepoJob(&conf, repo, src)
+		if err != nil {
+			failure.Exit(failure.Config, err)
+		}
+		tags, err := resolveTags(conf.Repos[repo], src)
+		if err != nil {
+			var f *failure.Error
+			if errors.As(err, &f) && f.Kind == failure.Config {
+				failure.Exit(failure.Config, err)
+			}
+			fmt.Printf("Error listing tags of %s: %v\n", repo, err)
+			failures.Add(failure.Clone, repo, err)
+			continue
+		}
+		channels := conf.RepoChannels(repo)
+		isChannel := map[string]bool{}
+		for _, ch := range channels {
+			isChannel[ch.Name] = true
+		}
+		for _, tag := range tags {
+			if isChannel[tag.Name] {
+				continue // indexed from the branch below
+			}
+			j := repoJob
+			j.Tag = tag.Name
+			j.Selector = tag.Selector
+			j.Ref = plumbing.NewTagReferenceName(tag.Name)
+			j.IndexedSHA = indexed[repo+"@"+tag.Name].SHA
+			j.IndexedModifiers = indexed[repo+"@"+tag.Name].Modifiers
+			jobs = append(jobs, j)
+		}
+		for _, ch := range channels {
+			j := repoJob
+			j.Tag = ch.Name
+			j.Selector = ch.Name
+			j.Ref = plumbing.NewBranchReferenceName(ch.Branch)
+			j.Branch = ch.Branch
+			j.Ordering = ch.Order
+			j.IndexedSHA = indexed[repo+"@"+ch.Name].SHA
+			j.IndexedModifiers = indexed[repo+"@"+ch.Name].Modifiers
+			jobs = append(jobs, j)
+		}
+		resolved[repo] = []string{}
+		for _, j := range jobs[first:] {
+			resolved[repo] = append(resolved[repo], j.Tag)
+		}
+	}
+
+	// index repos, cloning and parsing happens concurrently while the results
+	// are written in job order
+	results := make([]chan *result, len(jobs))
+	workers := make(chan struct{}, parallel)
+	for i, j := range jobs {
+		results[i] = make(chan *result, 1)
+		go func(j job, out chan<- *result) {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			log.Printf("Indexing repo %s from %s at tag: %s ...\n", j.Repo, j.Source, j.Tag)
+			out <- Index(j)
+		}(j, results[i])
+	}
+	report := []reportEntry{}
+	lintResults := []lint.Result{}
+	lintFailed := false
+	for i := range jobs {
+		res := <-results[i]
+		if res.Err == nil && !res.Skipped {
+			if err := store(db, res); err != nil {
+				res.Err, res.Kind = err, failure.Database
+			}
+		}
+		var lr []lint.Result
+		if res.Skipped {
+			if lr, err = loadSkipped(db, res); err != nil {
+				res.Err, res.Kind = err, failure.Database
+			}
+		} else {
+			lr = newLintResults(res)
+		}
+		lintResults = append(lintResults, lr...)
+		report = append(report, newReportEntry(res))
+		// Check for errors
+		subject := res.Repo + "@" + res.Tag
+		if res.Err != nil {
+			fmt.Printf("Error indexing %s: %v\n", subject, res.Err)
+			failures.Add(res.Kind, subject, res.Err)
+		}
+		if strict {
+			// skipped documents only fail the run in strict mode
+			for _, d := range res.Diagnostics {
+				if d.Severity == models.SeverityError {
+					failures.Add(failure.Parse, fmt.Sprintf("%s %s (document %d)", subject, d.Path, d.Document), errors.New(d.Message))
+				}
+			}
+		}
+		// lint issues fail the run if the repo is configured so, strict or not
+		for _, r := range lr {
+			for _, issue := range r.Issues {
+				if issue.Severity.AtLeast(res.LintFailOn) {
+					failures.Add(failure.Lint, fmt.Sprintf("%s %s", subject, r.CRD), errors.New(issue.String()))
+					lintFailed = true
+				}
+			}
+		}
+	}
+
+	for _, repo := range repos {
+		if tags, ok := resolved[repo]; ok {
+			if err := pruneTags(db, repo, tags); err != nil {
+				failures.Add(failure.Database, repo, err)
 			}
 		}
 	}
+
+	if reportFile != "" {
+		if err := writeReport(reportFile, report); err != nil {
+			log.Printf("Error writing report: %s: %v", reportFile, err)
+			failures.Add(failure.Render, reportFile, err)
+		}
+	}
+
+	if lintReportFile != "" {
+		if err := writeLintReport(lintReportFile, lintFormat, lintResults); err != nil {
+			log.Printf("Error writing lint report: %s: %v", lintReportFile, err)
+			failures.Add(failure.Render, lintReportFile, err)
+		}
+	}
+
+	failures.Summary(os.Stdout)
+	if strict || lintFailed {
+		os.Exit(failures.ExitCode())
+	}
 }
 
-// Index indexes a git repo at the specified url.
-func Index(db *sql.DB, repo string, tag string) error {
-	dir, err := os.MkdirTemp(os.TempDir(), "doc-gitter")
+// newRepoJob returns the job of a repo with the settings of the config, but
+// without tag. Invalid settings are returned as error.
+func newRepoJob(conf *config.Config, repo string, src source.Source) (job, error) {
+	d := conf.RepoDiscovery(repo)
+	m, err := discovery.NewMatcher(d.Include, d.Exclude, d.Match)
+	if err != nil {
+		return job{}, fmt.Errorf("discovery config of %s: %w", repo, err)
+	}
+	e := conf.RepoExamples(repo)
+	em, err := discovery.NewMatcher(e.Include, e.Exclude, nil)
+	if err != nil {
+		return job{}, fmt.Errorf("examples config of %s: %w", repo, err)
+	}
+	var mods []crd.Modifier
+	modNames := []string{}
+	for _, mc := range conf.RepoModifiers(repo) {
+		mod, err := crd.NewModifier(mc.Name, mc.Args)
+		if err != nil {
+			return job{}, fmt.Errorf("modifiers of %s: %w", repo, err)
+		}
+		mods = append(mods, mod)
+		modNames = append(modNames, mc.String())
+	}
+	lc := conf.RepoLint(repo)
+	linter, err := lint.New(lc.Rules)
+	if err != nil {
+		return job{}, fmt.Errorf("lint config of %s: %w", repo, err)
+	}
+	failOn := lint.Off
+	if lc.FailOn != "" {
+		if failOn, err = lint.ParseSeverity(lc.FailOn); err != nil {
+			return job{}, fmt.Errorf("lint config of %s: failOn: %w", repo, err)
+		}
+	}
+	return job{
+		Repo:          repo,
+		Source:        src,
+		Matcher:       m,
+		Examples:      em,
+		Helm:          conf.RepoHelm(repo),
+		Kustomize:     conf.RepoKustomize(repo),
+		Modifiers:     mods,
+		ModifierNames: modNames,
+		Linter:        linter,
+		LintFailOn:    failOn,
+	}, nil
+}
+
+// reportEntry is the outcome of indexing a single tag, as written to the
+// report.
+type reportEntry struct {
+	Repo        string              `json:"repo"`
+	Tag         string              `json:"tag"`
+	SHA         string              `json:"sha,omitempty"`
+	Skipped     bool                `json:"skipped"`
+	Error       string              `json:"error,omitempty"`
+	CRDs        []string            `json:"crds"`
+	Diagnostics []models.Diagnostic `json:"diagnostics"`
+}
+
+func newReportEntry(res *result) reportEntry {
+	e := reportEntry{
+		Repo:        res.Repo,
+		Tag:         res.Tag,
+		SHA:         res.SHA,
+		Skipped:     res.Skipped,
+		CRDs:        []string{},
+		Diagnostics: res.Diagnostics,
+	}
+	if res.Err != nil {
+		e.Error = res.Err.Error()
+	}
+	for k := range res.CRDs {
+		e.CRDs = append(e.CRDs, k)
+	}
+	sort.Strings(e.CRDs)
+	if e.Diagnostics == nil {
+		e.Diagnostics = []models.Diagnostic{}
+	}
+	return e
+}
+
+func writeReport(file string, report []reportEntry) error {
+	b, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
-	cloneOpts := &git.CloneOptions{
-		URL:               fmt.Sprintf("https://github.com/stackabletech/%s", repo),
-		Depth:             1,
-		Progress:          nil, // suppress progress output as it clogs up stdout otherwise
-		RecurseSubmodules: git.NoRecurseSubmodules,
-		ReferenceName:     plumbing.NewTagReferenceName(tag),
-		SingleBranch:      true,
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// newLintResults returns the lint issues of the CRDs of an indexed tag, in a
+// stable order.
+func newLintResults(res *result) []lint.Result {
+	keys := make([]string, 0, len(res.CRDs))
+	for k := range res.CRDs {
+		keys = append(keys, k)
 	}
-	if tag == "nightly" {
-		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName("main")
+	sort.Strings(keys)
+	results := make([]lint.Result, 0, len(keys))
+	for _, k := range keys {
+		issues := res.CRDs[k].Lint
+		if issues == nil {
+			issues = []lint.Issue{}
+		}
+		results = append(results, lint.Result{Repo: res.Repo, Tag: res.Tag, CRD: k, Issues: issues})
 	}
-	gitRepo, err := git.PlainClone(dir, false, cloneOpts)
+	return results
+}
+
+func writeLintReport(file string, format string, results []lint.Result) error {
+	f, err := os.Create(file)
 	if err != nil {
-		log.Printf("Failed to clone repo: %v", err)
 		return err
 	}
-	h, err := gitRepo.ResolveRevision(plumbing.Revision("HEAD"))
-	if err != nil || h == nil {
-		log.Printf("Unable to resolve revision: %s (%v)", tag, err)
+	if format == "json" {
+		err = lint.WriteJSON(f, results)
+	} else {
+		err = lint.WriteText(f, results)
+	}
+	if err != nil {
+		f.Close()
 		return err
 	}
-	c, err := gitRepo.CommitObject(*h)
-	if err != nil || c == nil {
-		log.Printf("Unable to resolve revision: %s (%v)", tag, err)
+	return f.Close()
+}
+
+// resolveTags resolves the tag patterns of a repo against the tags of its
+// source. The tags are only listed if there are patterns. Invalid patterns
+// are config failures.
+func resolveTags(repo config.Repo, src source.Source) ([]config.ResolvedTag, error) {
+	var available []string
+	if repo.HasTagPatterns() {
+		var err error
+		available, err = src.Tags()
+		if err != nil {
+			return nil, err
+		}
+	}
+	tags, err := repo.ResolveTags(available)
+	if err != nil {
+		return nil, failure.Wrap(failure.Config, src.String(), err)
+	}
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	log.Printf("Resolved tags of %s: %s", src, strings.Join(names, ", "))
+	return tags, nil
+}
+
+// indexedTag is a tag as indexed by a previous run.
+type indexedTag struct {
+	SHA string
+	// Modifiers are the modifiers applied to the CRDs of the tag as JSON,
+	// empty if the tag has no CRDs.
+	Modifiers string
+}
+
+// indexedTags returns the commit and modifiers each tag is indexed with,
+// keyed by repo@tag.
+func indexedTags(db *sql.DB) (map[string]indexedTag, error) {
+	c, err := db.Query("SELECT t.repo, t.name, t.sha, (SELECT c.modifiers FROM crds c WHERE c.tag_id = t.id LIMIT 1) FROM tags t")
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	indexed := map[string]indexedTag{}
+	for c.Next() {
+		var repo, tag string
+		var t indexedTag
+		var modifiers sql.NullString
+		if err := c.Scan(&repo, &tag, &t.SHA, &modifiers); err != nil {
+			return nil, err
+		}
+		t.Modifiers = modifiers.String
+		indexed[repo+"@"+tag] = t
+	}
+	return indexed, c.Err()
+}
+
+// loadSkipped loads the CRDs and diagnostics of a skipped tag into its
+// result, as they were recorded by the run which indexed the tag. As the lint
+// rules may have changed since, the CRDs are linted again and the stored lint
+// issues are replaced.
+func loadSkipped(db *sql.DB, res *result) ([]lint.Result, error) {
+	var err error
+	if res.CRDs, err = storedCRDs(db, res.Repo, res.Tag); err != nil {
+		return nil, err
+	}
+	if res.Diagnostics, err = storedDiagnostics(db, res.Repo, res.Tag); err != nil {
+		return nil, err
+	}
+	for k, r := range res.CRDs {
+		internal := &apiextensions.CustomResourceDefinition{}
+		if err := json.Unmarshal(r.CRD, internal); err != nil {
+			return nil, fmt.Errorf("stored CRD %s: %w", k, err)
+		}
+		c, err := crd.NewCRDerFromInternal(internal)
+		if err != nil {
+			return nil, fmt.Errorf("stored CRD %s: %w", k, err)
+		}
+		r.Lint = lintVersion(res.Linter, c, r.Version)
+		res.CRDs[k] = r
+	}
+	if err := replaceLintIssues(db, res); err != nil {
+		return nil, err
+	}
+	return newLintResults(res), nil
+}
+
+// storedCRDs returns the CRDs recorded for an indexed tag, with their
+// location and data.
+func storedCRDs(db *sql.DB, repo string, tag string) (map[string]models.RepoCRD, error) {
+	c, err := db.Query(`SELECT c.path, c.filename, c."group", c.version, c.kind, c.data FROM crds c INNER JOIN tags t ON (c.tag_id = t.id) WHERE t.repo=$1 AND t.name=$2`, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	crds := map[string]models.RepoCRD{}
+	for c.Next() {
+		var r models.RepoCRD
+		if err := c.Scan(&r.Path, &r.Filename, &r.Group, &r.Version, &r.Kind, &r.CRD); err != nil {
+			return nil, err
+		}
+		crds[crd.PrettyGVK(&schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind})] = r
+	}
+	return crds, c.Err()
+}
+
+// storedDiagnostics returns the diagnostics recorded for an indexed tag.
+func storedDiagnostics(db *sql.DB, repo string, tag string) (diagnostics, error) {
+	c, err := db.Query("SELECT d.path, d.document, d.severity, d.message FROM diagnostics d INNER JOIN tags t ON (d.tag_id = t.id) WHERE t.repo=$1 AND t.name=$2", repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var diags diagnostics
+	for c.Next() {
+		var d models.Diagnostic
+		if err := c.Scan(&d.Path, &d.Document, &d.Severity, &d.Message); err != nil {
+			return nil, err
+		}
+		diags = append(diags, d)
+	}
+	return diags, c.Err()
+}
+
+// Index indexes a git repo at the tag or branch of the job. Tags which are
+// already indexed at the same commit are skipped.
+func Index(j job) *result {
+	res := &result{job: j}
+	ref := j.Ref
+	sha, err := j.Source.Resolve(ref)
+	if err != nil {
+		log.Printf("Unable to resolve reference: %s (%v)", ref, err)
+		res.Err, res.Kind = err, failure.Clone
+		return res
+	}
+	if j.IndexedSHA == sha {
+		if !j.modifiersChanged() {
+			log.Printf("%s@%s is already indexed at %s, skipping", j.Repo, j.Tag, sha)
+			res.SHA = sha
+			res.Skipped = true
+			return res
+		}
+		log.Printf("%s@%s was indexed with the modifiers %s, re-indexing", j.Repo, j.Tag, j.IndexedModifiers)
+	}
+
+	co, err := j.Source.Checkout(ref)
+	if err != nil {
+		log.Printf("Failed to check out repo: %v", err)
+		res.Err, res.Kind = err, failure.Clone
+		return res
+	}
+	defer co.Close()
+	res.SHA = co.SHA
+	res.Time = co.Time
+	res.Author = co.Author
+	res.Tagger = co.Tagger
+	res.TagMessage = co.TagMessage
+	var crders map[string]*crd.CRDer
+	res.CRDs, crders, err = getCRDsFromTag(co.Dir, j, &res.Diagnostics)
+	if err != nil {
+		log.Printf("Unable to get CRDs: %s@%s (%v)", j.Repo, j.Tag, err)
+		res.Err, res.Kind = err, failure.Parse
+		return res
+	}
+	log.Printf("Found %d CRDs in %s@%s", len(res.CRDs), j.Repo, j.Tag)
+	res.Examples, err = getExamples(co.Dir, j, crders, &res.Diagnostics)
+	if err != nil {
+		log.Printf("Unable to get examples: %s@%s (%v)", j.Repo, j.Tag, err)
+		res.Err, res.Kind = err, failure.Parse
+		return res
+	}
+	log.Printf("Found %d examples in %s@%s", len(res.Examples), j.Repo, j.Tag)
+	return res
+}
+
+// store writes an indexed tag and its CRDs to the database. A previously
+// indexed version of the tag is replaced in the same transaction, so a failure
+// never leaves a half indexed tag behind.
+func store(db *sql.DB, res *result) error {
+	tx, err := db.Begin()
+	if err != nil {
 		return err
 	}
-	time := c.Committer.When
-	if tag == "nightly" {
-		time = time.AddDate(-50, 0, 0) // backdate the nightly so it comes last in the sorting
+	defer tx.Rollback()
+	if res.IndexedSHA != "" && res.IndexedSHA != res.SHA {
+		log.Printf("%s@%s moved from %s to %s, re-indexing", res.Repo, res.Tag, res.IndexedSHA, res.SHA)
+	}
+	// tags indexed before commits were recorded have none, their rows are
+	// replaced all the same
+	if err := deleteTag(tx, res.Repo, res.Tag); err != nil {
+		return err
 	}
 	var tagID int
-	r := db.QueryRow("INSERT INTO tags(name, repo, time) VALUES ($1, $2, $3) RETURNING id", tag, repo, time)
+	r := tx.QueryRow("INSERT INTO tags(name, repo, source, sha, selector, branch, ordering, author, tagger, tag_message, time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id", res.Tag, res.Repo, res.Source.String(), res.SHA, res.Selector, res.Branch, res.Ordering, res.Author, res.Tagger, res.TagMessage, res.Time)
 	if err := r.Scan(&tagID); err != nil {
 		return err
 	}
-	w, err := gitRepo.Worktree()
+	if len(res.CRDs) > 0 {
+		// insert in a stable order, keeps the database deterministic
+		keys := make([]string, 0, len(res.CRDs))
+		for k := range res.CRDs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		allArgs := make([]interface{}, 0, len(res.CRDs)*crdArgCount)
+		for _, k := range keys {
+			crd := res.CRDs[k]
+			m := crd.Metadata
+			columns, err := json.Marshal(m.PrinterColumns)
+			if err != nil {
+				return err
+			}
+			modifiers, err := json.Marshal(crd.Modifiers)
+			if err != nil {
+				return err
+			}
+			allArgs = append(allArgs, crd.Group, crd.Version, crd.Kind, tagID, crd.Filename, crd.Path, crd.CRD, string(crd.SourceYAML), crd.Served, crd.Storage, crd.Deprecated, crd.DeprecationWarning,
+				// lists are stored comma separated, so they can be queried with LIKE
+				m.Scope, strings.Join(m.ShortNames, ","), strings.Join(m.Categories, ","), strings.Join(m.Subresources, ","), string(columns), string(modifiers),
+				crd.Coverage.Properties, crd.Coverage.Described, crd.Coverage.Percent())
+		}
+		if _, err := tx.Exec(buildInsert("INSERT INTO crds(\"group\", version, kind, tag_id, filename, path, data, source_yaml, served, storage, deprecated, deprecation_warning, scope, short_names, categories, subresources, printer_columns, modifiers, properties, described_properties, description_coverage) VALUES ", crdArgCount, len(res.CRDs))+"ON CONFLICT DO NOTHING", allArgs...); err != nil {
+			return err
+		}
+		if err := insertLintIssues(tx, tagID, res.CRDs); err != nil {
+			return err
+		}
+	}
+	if len(res.Diagnostics) > 0 {
+		allArgs := make([]interface{}, 0, len(res.Diagnostics)*diagnosticArgCount)
+		for _, d := range res.Diagnostics {
+			allArgs = append(allArgs, tagID, d.Path, d.Document, d.Severity, d.Message)
+		}
+		if _, err := tx.Exec(buildInsert("INSERT INTO diagnostics(tag_id, path, document, severity, message) VALUES ", diagnosticArgCount, len(res.Diagnostics)), allArgs...); err != nil {
+			return err
+		}
+	}
+	if len(res.Examples) > 0 {
+		allArgs := make([]interface{}, 0, len(res.Examples)*exampleArgCount)
+		for _, e := range res.Examples {
+			allArgs = append(allArgs, tagID, e.Group, e.Version, e.Kind, e.Name, e.Path, e.Document, string(e.Data), e.Valid, e.Error)
+		}
+		if _, err := tx.Exec(buildInsert("INSERT INTO examples(tag_id, \"group\", version, kind, name, path, document, data, valid, error) VALUES ", exampleArgCount, len(res.Examples)), allArgs...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteTag removes a tag with all its rows.
+func deleteTag(tx *sql.Tx, repo string, tag string) error {
+	for _, table := range []string{"crds", "diagnostics", "examples", "lint_issues"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE tag_id IN (SELECT id FROM tags WHERE name=$1 AND repo=$2)", tag, repo); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("DELETE FROM tags WHERE name=$1 AND repo=$2", tag, repo)
+	return err
+}
+
+// pruneTags removes the stored tags of a repo which are not among its
+// resolved tags anymore, e.g. because they were removed from the config or
+// dropped out of a version range, so doc does not publish them.
+func pruneTags(db *sql.DB, repo string, tags []string) error {
+	keep := map[string]bool{}
+	for _, t := range tags {
+		keep[t] = true
+	}
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Failed to get worktree: %v", err)
 		return err
 	}
-	repoCRDs, err := getCRDsFromTag(dir, w)
+	defer tx.Rollback()
+	c, err := tx.Query("SELECT name FROM tags WHERE repo=$1", repo)
 	if err != nil {
-		log.Printf("Unable to get CRDs: %s@%s (%v)", repo, tag, err)
 		return err
 	}
-	log.Printf("Found %d CRDs", len(repoCRDs))
-	if len(repoCRDs) > 0 {
-		allArgs := make([]interface{}, 0, len(repoCRDs)*crdArgCount)
-		for _, crd := range repoCRDs {
-			allArgs = append(allArgs, crd.Group, crd.Version, crd.Kind, tagID, crd.Filename, crd.CRD)
+	var stale []string
+	for c.Next() {
+		var t string
+		if err := c.Scan(&t); err != nil {
+			c.Close()
+			return err
+		}
+		if !keep[t] {
+			stale = append(stale, t)
 		}
-		if _, err := db.Exec(buildInsert("INSERT INTO crds(\"group\", version, kind, tag_id, filename, data) VALUES ", crdArgCount, len(repoCRDs))+"ON CONFLICT DO NOTHING", allArgs...); err != nil {
+	}
+	c.Close()
+	if err := c.Err(); err != nil {
+		return err
+	}
+	for _, t := range stale {
+		log.Printf("%s@%s is not configured anymore, removing it", repo, t)
+		if err := deleteTag(tx, repo, t); err != nil {
 			return err
 		}
 	}
+	return tx.Commit()
+}
 
+// insertLintIssues writes the lint issues of the CRDs of a tag, in a stable
+// order.
+func insertLintIssues(tx *sql.Tx, tagID int, crds map[string]models.RepoCRD) error {
+	keys := make([]string, 0, len(crds))
+	for k := range crds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	issueArgs := []interface{}{}
+	for _, k := range keys {
+		crd := crds[k]
+		for _, i := range crd.Lint {
+			issueArgs = append(issueArgs, tagID, crd.Group, crd.Version, crd.Kind, i.Rule, string(i.Severity), i.Path, i.Message)
+		}
+	}
+	// schemas without descriptions have many issues, insert them in
+	// batches to stay below the limit of query parameters
+	for len(issueArgs) > 0 {
+		n := len(issueArgs)
+		if n > lintIssueBatch*lintIssueArgCount {
+			n = lintIssueBatch * lintIssueArgCount
+		}
+		if _, err := tx.Exec(buildInsert("INSERT INTO lint_issues(tag_id, \"group\", version, kind, rule, severity, path, message) VALUES ", lintIssueArgCount, n/lintIssueArgCount), issueArgs[:n]...); err != nil {
+			return err
+		}
+		issueArgs = issueArgs[n:]
+	}
 	return nil
 }
 
-func getCRDsFromTag(dir string, w *git.Worktree) (map[string]models.RepoCRD, error) {
-	reg := regexp.MustCompile("kind: CustomResourceDefinition")
-	regPath := regexp.MustCompile(`^deploy/helm/.*\.yaml`)
-	g, _ := w.Grep(&git.GrepOptions{
-		Patterns:  []*regexp.Regexp{reg},
-		PathSpecs: []*regexp.Regexp{regPath},
-	})
+// replaceLintIssues replaces the stored lint issues of an indexed tag with
+// those of its CRDs.
+func replaceLintIssues(db *sql.DB, res *result) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var tagID int
+	if err := tx.QueryRow("SELECT id FROM tags WHERE name=$1 AND repo=$2", res.Tag, res.Repo).Scan(&tagID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM lint_issues WHERE tag_id=$1", tagID); err != nil {
+		return err
+	}
+	if err := insertLintIssues(tx, tagID, res.CRDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getCRDsFromTag returns the CRDs found in dir, keyed by group, kind and
+// version, and a CRDer for each CRD, keyed by group and kind.
+func getCRDsFromTag(dir string, j job, d *diagnostics) (map[string]models.RepoCRD, map[string]*crd.CRDer, error) {
+	g, err := j.Matcher.Find(dir)
+	if err != nil {
+		return nil, nil, err
+	}
 	repoCRDs := map[string]models.RepoCRD{}
-	files := getYAMLs(g, dir)
+	crders := map[string]*crd.CRDer{}
+	files := map[string][][]byte{}
+	var charts []string
+	if !j.Helm.Disabled {
+		files, charts, err = renderCharts(dir, j.Helm, j.Matcher, d)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, k := range j.Kustomize.Dirs {
+		b, err := kustomize.Build(j.Kustomize.Binary, dir+"/"+k)
+		if err != nil {
+			d.add(models.SeverityError, k, -1, "failed to build kustomization: %v", err)
+			continue
+		}
+		if !j.Matcher.MatchContent(b) {
+			continue
+		}
+		files[k] = splitYAML(b, k, d)
+	}
+	// rendered templates replace the raw template files, also those which
+	// render to nothing or are not CRDs
+	raw := []string{}
+	for _, file := range g {
+		if _, ok := files[file]; !ok && !isTemplate(file, charts) {
+			raw = append(raw, file)
+		}
+	}
+	for file, yamls := range getYAMLs(raw, dir, d) {
+		files[file] = yamls
+	}
 	log.Printf("found files: %d", len(files))
-	for file, yamls := range files {
-		for _, y := range yamls {
-			crder, err := crd.NewCRDer(y, crd.StripLabels(), crd.StripAnnotations(), crd.StripConversion())
-			if err != nil || crder.CRD == nil {
-				log.Printf("error: %v", err)
+	filenames := make([]string, 0, len(files))
+	for file := range files {
+		filenames = append(filenames, file)
+	}
+	sort.Strings(filenames)
+	for _, file := range filenames {
+		for i, y := range files[file] {
+			if y == nil {
+				continue // failed to parse, already recorded
+			}
+			if !isCRD(y) {
+				continue
+			}
+			crder, err := crd.NewCRDer(y, j.Modifiers...)
+			if err != nil {
+				d.add(models.SeverityError, file, i, "skipped CRD: %v", err)
 				continue
 			}
+			for _, w := range crder.Warnings {
+				d.add(models.SeverityWarning, file, i, "%s", w)
+			}
 			cbytes, err := json.Marshal(crder.CRD)
 			if err != nil {
-				log.Printf("Error marshalling: %v", err)
+				d.add(models.SeverityError, file, i, "skipped CRD, failed to marshal: %v", err)
 				continue
 			}
-			repoCRDs[crd.PrettyGVK(crder.GVK)] = models.RepoCRD{
-				Path:     crd.PrettyGVK(crder.GVK),
-				Filename: path.Base(file),
-				Group:    crder.GVK.Group,
-				Version:  crder.GVK.Version,
-				Kind:     crder.GVK.Kind,
-				CRD:      cbytes,
+			crders[crder.GVK.Group+"/"+crder.GVK.Kind] = crder
+			// every served version is documented, each with its own row
+			for _, v := range crder.Versions() {
+				gvk := schema.GroupVersionKind{Group: crder.GVK.Group, Version: v.Name, Kind: crder.GVK.Kind}
+				key := crd.PrettyGVK(&gvk)
+				if prev, ok := repoCRDs[key]; ok {
+					d.add(models.SeverityWarning, file, i, "%s is also defined in %s, which is replaced", key, prev.Path)
+				}
+				repoCRDs[key] = models.RepoCRD{
+					Path:               file,
+					Filename:           path.Base(file),
+					Group:              gvk.Group,
+					Version:            gvk.Version,
+					Kind:               gvk.Kind,
+					CRD:                cbytes,
+					SourceYAML:         y,
+					Served:             v.Served,
+					Storage:            v.Storage,
+					Deprecated:         v.Deprecated,
+					DeprecationWarning: v.DeprecationWarning,
+					Metadata:           crd.VersionMetadata(crder.CRD, v.Name),
+					Modifiers:          j.ModifierNames,
+					Coverage:           versionCoverage(crder, v.Name),
+					Lint:               lintVersion(j.Linter, crder, v.Name),
+				}
 			}
 		}
 	}
-	return repoCRDs, nil
+	return repoCRDs, crders, nil
 }
 
-func getYAMLs(greps []git.GrepResult, dir string) map[string][][]byte {
-	allCRDs := map[string][][]byte{}
-	for _, res := range greps {
-		b, err := os.ReadFile(dir + "/" + res.FileName)
+// lintVersion returns the lint issues of the schema of a version, none if it
+// has no schema.
+func lintVersion(l *lint.Linter, c *crd.CRDer, version string) []lint.Issue {
+	s := crd.VersionSchema(c.CRD, version)
+	if l == nil || s == nil || s.OpenAPIV3Schema == nil {
+		return []lint.Issue{}
+	}
+	return l.Lint(s.OpenAPIV3Schema)
+}
+
+// versionCoverage returns the description coverage of the schema of a
+// version.
+func versionCoverage(c *crd.CRDer, version string) crd.Coverage {
+	s := crd.VersionSchema(c.CRD, version)
+	if s == nil {
+		return crd.Coverage{}
+	}
+	return crd.DescriptionCoverage(s.OpenAPIV3Schema)
+}
+
+// getExamples returns the example custom resources found in dir, validated
+// against their CRD. Documents of kinds which are not defined by the CRDs of
+// the tag are no examples and skipped.
+func getExamples(dir string, j job, crders map[string]*crd.CRDer, d *diagnostics) ([]models.Example, error) {
+	files, err := j.Examples.Find(dir)
+	if err != nil {
+		return nil, err
+	}
+	examples := []models.Example{}
+	yamls := readExamples(files, dir, d)
+	for _, file := range files {
+		for i, y := range yamls[file] {
+			if y == nil {
+				continue // failed to parse, already recorded
+			}
+			var meta struct {
+				APIVersion string `yaml:"apiVersion"`
+				Kind       string `yaml:"kind"`
+				Metadata   struct {
+					Name string `yaml:"name"`
+				} `yaml:"metadata"`
+			}
+			if err := yaml.Unmarshal(y, &meta); err != nil {
+				continue
+			}
+			gv, err := schema.ParseGroupVersion(meta.APIVersion)
+			if err != nil {
+				continue
+			}
+			crder, ok := crders[gv.Group+"/"+meta.Kind]
+			if !ok {
+				continue
+			}
+			e := models.Example{
+				Path:     file,
+				Document: i,
+				Group:    gv.Group,
+				Version:  gv.Version,
+				Kind:     meta.Kind,
+				Name:     meta.Metadata.Name,
+				Data:     y,
+				Valid:    true,
+			}
+			res, err := crder.ValidateDetailed(y)
+			if err == nil {
+				err = res.Err()
+				for _, w := range res.Warnings {
+					d.add(models.SeverityWarning, file, i, "example %s: %s", e.Name, w)
+				}
+				for _, p := range res.Pruned {
+					d.add(models.SeverityWarning, file, i, "example %s: %s would be pruned, it is unknown to the schema", e.Name, p)
+				}
+			}
+			if err != nil {
+				e.Valid = false
+				e.Error = err.Error()
+				d.add(models.SeverityWarning, file, i, "invalid example %s: %v", e.Name, err)
+			}
+			examples = append(examples, e)
+		}
+	}
+	return examples, nil
+}
+
+// readExamples reads the documents of the example files like getYAMLs does.
+// Examples are no part of the documented CRDs, so files and documents which
+// can't be read are only recorded as warnings.
+func readExamples(files []string, dir string, d *diagnostics) map[string][][]byte {
+	examples := map[string][][]byte{}
+	for _, file := range files {
+		b, err := os.ReadFile(dir + "/" + file)
 		if err != nil {
-			log.Printf("failed to read CRD file: %s", res.FileName)
+			d.add(models.SeverityWarning, file, -1, "failed to read example file: %v", err)
 			continue
 		}
+		var yamls [][]byte
+		for _, doc := range manifest.Split(b) {
+			if err := decodeDocument(doc.Data); err != nil {
+				d.add(models.SeverityWarning, file, len(yamls), "failed to decode example: %v", err)
+				yamls = append(yamls, nil)
+				continue
+			}
+			yamls = append(yamls, doc.Data)
+		}
+		examples[file] = yamls
+	}
+	return examples
+}
 
-		yamls, err := splitYAML(b, res.FileName)
+// renderCharts renders all Helm charts in dir and returns the documents of
+// the rendered templates whose path and content match, keyed by template
+// path, and the charts which were rendered.
+func renderCharts(dir string, h config.Helm, m *discovery.Matcher, d *diagnostics) (map[string][][]byte, []string, error) {
+	charts, err := helm.FindCharts(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	allCRDs := map[string][][]byte{}
+	renderedCharts := []string{}
+	for _, chart := range charts {
+		rendered, err := helm.Render(dir+"/"+chart, h.Values)
 		if err != nil {
-			log.Printf("failed to split/parse CRD file: %s", res.FileName)
+			d.add(models.SeverityError, chart, -1, "failed to render Helm chart: %v", err)
 			continue
 		}
-
-		allCRDs[res.FileName] = yamls
+		renderedCharts = append(renderedCharts, chart)
+		for file, b := range rendered {
+			file = path.Join(chart, file)
+			if !m.MatchPath(file) || !m.MatchContent(b) {
+				continue
+			}
+			allCRDs[file] = splitYAML(b, file, d)
+		}
 	}
-	return allCRDs
+	return allCRDs, renderedCharts, nil
 }
 
-func splitYAML(file []byte, filename string) ([][]byte, error) {
-	var yamls [][]byte
-	var err error = nil
-	defer func() {
-		if err := recover(); err != nil {
-			yamls = make([][]byte, 0)
-			err = fmt.Errorf("panic while processing yaml file: %v", err)
+// isTemplate returns true if the file is a template of any of the charts or
+// of their subcharts, e.g. deploy/helm/op/templates/crds.yaml. Charts may be
+// at the root of the repo, as ".".
+func isTemplate(file string, charts []string) bool {
+	for _, chart := range charts {
+		rel, err := filepath.Rel(filepath.FromSlash(chart), filepath.FromSlash(file))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
 		}
-	}()
-
-	decoder := yaml.NewDecoder(bytes.NewReader(file))
-	for {
-		var node map[string]interface{}
-		err := decoder.Decode(&node)
-		if err == io.EOF {
-			break
+		for _, segment := range strings.Split(path.Dir(filepath.ToSlash(rel)), "/") {
+			if segment == "templates" {
+				return true
+			}
 		}
+	}
+	return false
+}
+
+func getYAMLs(files []string, dir string, d *diagnostics) map[string][][]byte {
+	allCRDs := map[string][][]byte{}
+	for _, file := range files {
+		b, err := os.ReadFile(dir + "/" + file)
 		if err != nil {
-			log.Printf("failed to decode part of CRD file: %s\n%s", filename, err)
+			d.add(models.SeverityError, file, -1, "failed to read CRD file: %v", err)
 			continue
 		}
 
-		doc, err := yaml.Marshal(node)
-		if err != nil {
-			log.Printf("failed to encode part of CRD file: %s\n%s", filename, err)
+		allCRDs[file] = splitYAML(b, file, d)
+	}
+	return allCRDs
+}
+
+// splitYAML splits a file into its documents and returns their original
+// text. Each document is parsed on its own, documents which can't be parsed
+// are recorded and returned as nil, so the index of a document in the result
+// is its index in the file. Empty documents are dropped.
+func splitYAML(file []byte, filename string, d *diagnostics) [][]byte {
+	var yamls [][]byte
+	for _, doc := range manifest.Split(file) {
+		if err := decodeDocument(doc.Data); err != nil {
+			d.add(models.SeverityError, filename, len(yamls), "failed to decode document: %v", err)
+			yamls = append(yamls, nil)
 			continue
 		}
-		yamls = append(yamls, doc)
+		yamls = append(yamls, doc.Data)
+	}
+	return yamls
+}
+
+// decodeDocument checks that a document is a valid YAML mapping.
+func decodeDocument(doc []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing yaml document: %v", r)
+		}
+	}()
+	var node map[string]interface{}
+	return yaml.Unmarshal(doc, &node)
+}
+
+// isCRD returns true if the document is a CustomResourceDefinition, other
+// documents in the same file are skipped without a diagnostic.
+func isCRD(doc []byte) bool {
+	var meta struct {
+		Kind string `yaml:"kind"`
 	}
-	return yamls, err
+	return yaml.Unmarshal(doc, &meta) == nil && meta.Kind == "CustomResourceDefinition"
 }
 
 func buildInsert(query string, argsPerInsert, numInsert int) string {
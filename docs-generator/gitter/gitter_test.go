@@ -0,0 +1,429 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"docs-generator/internal/testutil"
+	"docs-generator/pkg/config"
+	"docs-generator/pkg/crd/lint"
+	"docs-generator/pkg/models"
+	"docs-generator/pkg/source"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+var multiDoc = []byte(`kind: A
+---
+- not a mapping
+---
+kind: B`)
+
+func TestSplitYAML(t *testing.T) {
+	var d diagnostics
+	yamls := splitYAML(multiDoc, "crds.yaml", &d)
+	if len(yamls) != 3 {
+		t.Fatalf("Expected 3 documents, got %d: %q", len(yamls), yamls)
+	}
+	if string(yamls[0]) != "kind: A\n" {
+		t.Errorf("Expected the original text of the first document, got %q", yamls[0])
+	}
+	if yamls[1] != nil {
+		t.Errorf("Expected the invalid document to be nil, got %q", yamls[1])
+	}
+	if string(yamls[2]) != "kind: B\n" {
+		t.Errorf("Expected the last document, got %q", yamls[2])
+	}
+	if len(d) != 1 || d[0].Document != 1 || d[0].Path != "crds.yaml" {
+		t.Errorf("Expected a diagnostic for document 1, got %+v", d)
+	}
+}
+
+func crdYAML(kind string) string {
+	return `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: ` + strings.ToLower(kind) + `s.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    plural: ` + strings.ToLower(kind) + `s
+    kind: ` + kind + `
+  versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              description: The spec.
+              type: object
+`
+}
+
+// newTestDB returns an in-memory database with the schema.
+func newTestDB(t *testing.T) *sql.DB {
+	schema, err := os.ReadFile("../../schema/crds_up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// indexTag indexes the tag of the repo like a run of gitter with the config
+// does, and returns the result.
+func indexTag(t *testing.T, db *sql.DB, conf *config.Config, repo string, src source.Source, tag string) *result {
+	j, err := newRepoJob(conf, repo, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := indexedTags(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Tag = tag
+	j.Selector = tag
+	j.Ref = plumbing.NewTagReferenceName(tag)
+	j.IndexedSHA = indexed[repo+"@"+tag].SHA
+	j.IndexedModifiers = indexed[repo+"@"+tag].Modifiers
+	res := Index(j)
+	if res.Err != nil {
+		t.Fatalf("Failed to index %s@%s: %s", repo, tag, res.Err)
+	}
+	if !res.Skipped {
+		if err := store(db, res); err != nil {
+			t.Fatalf("Failed to store %s@%s: %s", repo, tag, err)
+		}
+	}
+	return res
+}
+
+// storedKinds returns the kinds stored for a tag, and the commit of the tag.
+func storedKinds(t *testing.T, db *sql.DB, repo string, tag string) ([]string, string) {
+	var sha string
+	if err := db.QueryRow("SELECT sha FROM tags WHERE repo=$1 AND name=$2", repo, tag).Scan(&sha); err != nil {
+		t.Fatal(err)
+	}
+	c, err := db.Query("SELECT c.kind FROM crds c JOIN tags t ON (c.tag_id = t.id) WHERE t.repo=$1 AND t.name=$2 ORDER BY c.kind", repo, tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	kinds := []string{}
+	for c.Next() {
+		var k string
+		if err := c.Scan(&k); err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, sha
+}
+
+func TestIndexMovedTag(t *testing.T) {
+	dir := t.TempDir()
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{"deploy/helm/op/crds/crds.yaml": crdYAML("Widget")})
+	db := newTestDB(t)
+	conf := &config.Config{Helm: config.Helm{Disabled: true}}
+	src := &source.Git{URL: "file://" + dir}
+
+	first := indexTag(t, db, conf, "op", src, "1.0.0")
+	kinds, sha := storedKinds(t, db, "op", "1.0.0")
+	if !reflect.DeepEqual(kinds, []string{"Widget"}) || sha != first.SHA {
+		t.Fatalf("Unexpected first index: %v at %s", kinds, sha)
+	}
+
+	skipped := indexTag(t, db, conf, "op", src, "1.0.0")
+	if !skipped.Skipped || skipped.SHA != first.SHA {
+		t.Errorf("Expected the unchanged tag to be skipped at %s, got %s", first.SHA, skipped.SHA)
+	}
+	if _, err := loadSkipped(db, skipped); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := newReportEntry(skipped).CRDs, newReportEntry(first).CRDs; len(got) != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the skipped tag to report the stored CRDs %v, got %v", want, got)
+	}
+
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{"deploy/helm/op/crds/gadgets.yaml": crdYAML("Gadget")})
+	moved := indexTag(t, db, conf, "op", src, "1.0.0")
+	if moved.Skipped || moved.SHA == first.SHA {
+		t.Fatalf("Expected the moved tag to be indexed again")
+	}
+	kinds, sha = storedKinds(t, db, "op", "1.0.0")
+	if !reflect.DeepEqual(kinds, []string{"Gadget", "Widget"}) || sha != moved.SHA {
+		t.Errorf("Expected the tag to be replaced, got %v at %s", kinds, sha)
+	}
+	var tags int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tags").Scan(&tags); err != nil || tags != 1 {
+		t.Errorf("Expected a single tag row, got %d (%v)", tags, err)
+	}
+}
+
+func TestStoreReplacesUnrecordedCommit(t *testing.T) {
+	db := newTestDB(t)
+	// a tag indexed before commits were recorded, as left by the migration
+	if _, err := db.Exec("INSERT INTO tags(name, repo, source, sha, selector) VALUES ('1.0.0', 'op', '', '', '')"); err != nil {
+		t.Fatal(err)
+	}
+	res := &result{job: job{Repo: "op", Tag: "1.0.0", Source: &source.Local{Path: "/op"}}, SHA: "abc"}
+	if err := store(db, res); err != nil {
+		t.Fatalf("Failed to replace the tag: %s", err)
+	}
+	if _, sha := storedKinds(t, db, "op", "1.0.0"); sha != "abc" {
+		t.Errorf("Expected the tag to be replaced, got commit %q", sha)
+	}
+}
+
+var chart = map[string]string{
+	"deploy/helm/op/Chart.yaml": `
+apiVersion: v2
+name: op
+version: 0.1.0
+`,
+	"deploy/helm/op/values.yaml": `
+crds:
+  install: false
+`,
+	"deploy/helm/op/templates/crds.yaml": `{{- if .Values.crds.install }}
+` + crdYAML("Widget") + `{{- end }}
+`,
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHelmTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, chart)
+	// a repo which is a chart itself
+	root := t.TempDir()
+	rootChart := map[string]string{}
+	for name, content := range chart {
+		rootChart[strings.TrimPrefix(name, "deploy/helm/op/")] = content
+	}
+	writeFiles(t, root, rootChart)
+	install := map[string]interface{}{"crds": map[interface{}]interface{}{"install": true}}
+
+	cases := []struct {
+		name  string
+		root  bool
+		conf  config.Config
+		kinds int
+	}{
+		{name: "rendered", conf: config.Config{Helm: config.Helm{Values: install}}, kinds: 1},
+		{name: "renders to nothing", kinds: 0},
+		{name: "root chart renders to nothing", root: true, conf: config.Config{Discovery: config.Discovery{Include: []string{"**/*.yaml"}}}, kinds: 0},
+		{
+			name:  "root chart",
+			root:  true,
+			conf:  config.Config{Helm: config.Helm{Values: install}, Discovery: config.Discovery{Include: []string{"**/*.yaml"}}},
+			kinds: 1,
+		},
+		{
+			name: "excluded",
+			conf: config.Config{
+				Helm:      config.Helm{Values: install},
+				Discovery: config.Discovery{Exclude: []string{"**/templates/**"}},
+			},
+			kinds: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := dir
+			if tc.root {
+				dir = root
+			}
+			j, err := newRepoJob(&tc.conf, "op", &source.Local{Path: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d diagnostics
+			crds, _, err := getCRDsFromTag(dir, j, &d)
+			if err != nil {
+				t.Fatalf("Failed to get CRDs: %s", err)
+			}
+			if len(crds) != tc.kinds {
+				found := []string{}
+				for k, c := range crds {
+					found = append(found, k+" in "+c.Path)
+				}
+				t.Errorf("Expected %d CRDs, got %v", tc.kinds, found)
+			}
+			if len(d) != 0 {
+				t.Errorf("Expected no diagnostics, got %+v", d)
+			}
+		})
+	}
+}
+
+func TestKustomize(t *testing.T) {
+	// the fake kubectl prints the CRDs of the kustomization, and fails if there are none
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = kustomize ] && cat \"$2/crds.yaml\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config/crd/crds.yaml": crdYAML("Widget")})
+
+	conf := &config.Config{Kustomize: config.Kustomize{Binary: "kubectl", Dirs: []string{"config/crd", "config/broken"}}}
+	j, err := newRepoJob(conf, "op", &source.Local{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d diagnostics
+	crds, _, err := getCRDsFromTag(dir, j, &d)
+	if err != nil {
+		t.Fatalf("Failed to get CRDs: %s", err)
+	}
+	if len(crds) != 1 {
+		t.Errorf("Expected the CRD of config/crd, got %d CRDs", len(crds))
+	}
+	if len(d) != 1 || d[0].Path != "config/broken" || d[0].Document != -1 || d[0].Severity != models.SeverityError ||
+		!strings.HasPrefix(d[0].Message, "failed to build kustomization: kubectl kustomize") {
+		t.Errorf("Expected the failed build of config/broken as an error, got %+v", d)
+	}
+}
+
+func TestIndexChangedModifiers(t *testing.T) {
+	dir := t.TempDir()
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{"deploy/helm/op/crds/crds.yaml": crdYAML("Widget")})
+	db := newTestDB(t)
+	conf := &config.Config{Helm: config.Helm{Disabled: true}}
+	src := &source.Git{URL: "file://" + dir}
+
+	first := indexTag(t, db, conf, "op", src, "1.0.0")
+	if res := indexTag(t, db, conf, "op", src, "1.0.0"); !res.Skipped {
+		t.Fatalf("Expected the unchanged tag to be skipped")
+	}
+
+	conf.Modifiers = []config.Modifier{{Name: "stripStatus"}}
+	changed := indexTag(t, db, conf, "op", src, "1.0.0")
+	if changed.Skipped || changed.SHA != first.SHA {
+		t.Fatalf("Expected the tag to be indexed again at the same commit")
+	}
+	var modifiers string
+	if err := db.QueryRow("SELECT modifiers FROM crds").Scan(&modifiers); err != nil || modifiers != `["stripStatus"]` {
+		t.Errorf("Expected the new modifiers to be stored, got %s (%v)", modifiers, err)
+	}
+	if res := indexTag(t, db, conf, "op", src, "1.0.0"); !res.Skipped {
+		t.Errorf("Expected the tag to be skipped with the same modifiers")
+	}
+}
+
+func TestRelintSkippedTag(t *testing.T) {
+	dir := t.TempDir()
+	// replicas has no description
+	widget := crdYAML("Widget") + "            replicas:\n              type: integer\n"
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{"deploy/helm/op/crds/crds.yaml": widget})
+	db := newTestDB(t)
+	conf := &config.Config{Helm: config.Helm{Disabled: true}}
+	src := &source.Git{URL: "file://" + dir}
+	indexTag(t, db, conf, "op", src, "1.0.0")
+
+	// the stricter rules apply although the tag did not move
+	conf.Lint = config.Lint{Rules: map[string]string{"missing-description": "error"}, FailOn: "error"}
+	res := indexTag(t, db, conf, "op", src, "1.0.0")
+	if !res.Skipped {
+		t.Fatalf("Expected the unchanged tag to be skipped")
+	}
+	results, err := loadSkipped(db, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Issues) != 1 || results[0].Issues[0].Severity != lint.Error {
+		t.Fatalf("Expected the missing description as error, got %+v", results)
+	}
+	var severity string
+	if err := db.QueryRow("SELECT severity FROM lint_issues WHERE rule='missing-description'").Scan(&severity); err != nil || severity != "error" {
+		t.Errorf("Expected the stored issue to be replaced, got %s (%v)", severity, err)
+	}
+}
+
+func TestPruneTags(t *testing.T) {
+	dir := t.TempDir()
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{"deploy/helm/op/crds/crds.yaml": crdYAML("Widget")})
+	testutil.CommitTag(t, dir, "1.1.0", map[string]string{"deploy/helm/op/crds/gadgets.yaml": crdYAML("Gadget")})
+	db := newTestDB(t)
+	conf := &config.Config{Helm: config.Helm{Disabled: true}}
+	src := &source.Git{URL: "file://" + dir}
+	indexTag(t, db, conf, "op", src, "1.0.0")
+	indexTag(t, db, conf, "op", src, "1.1.0")
+	indexTag(t, db, conf, "other", src, "1.0.0")
+
+	// 1.0.0 dropped out of the config of op
+	if err := pruneTags(db, "op", []string{"1.1.0"}); err != nil {
+		t.Fatalf("Failed to prune tags: %s", err)
+	}
+	var tags, crds int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tags WHERE repo='op' AND name='1.0.0'").Scan(&tags); err != nil || tags != 0 {
+		t.Errorf("Expected the stale tag to be removed, got %d (%v)", tags, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM crds c JOIN tags t ON (c.tag_id = t.id) WHERE t.repo='op'").Scan(&crds); err != nil || crds != 2 {
+		t.Errorf("Expected only the CRDs of 1.1.0 to be left, got %d (%v)", crds, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM crds").Scan(&crds); err != nil || crds != 3 {
+		t.Errorf("Expected the CRDs of other repos to be kept, got %d (%v)", crds, err)
+	}
+}
+
+func TestExamplesWithInvalidDocuments(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"deploy/helm/op/crds/crds.yaml": crdYAML("Widget"),
+		"docs/modules/op/examples/widget.yaml": `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: simple
+---
+kind: [broken
+`,
+	})
+	j, err := newRepoJob(&config.Config{Helm: config.Helm{Disabled: true}}, "op", &source.Local{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d diagnostics
+	_, crders, err := getCRDsFromTag(dir, j, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples, err := getExamples(dir, j, crders, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(examples) != 1 || !examples[0].Valid {
+		t.Errorf("Expected the valid example, got %+v", examples)
+	}
+	if len(d) != 1 || d[0].Severity != models.SeverityWarning || d[0].Document != 1 || !strings.HasPrefix(d[0].Message, "failed to decode example") {
+		t.Errorf("Expected the broken document as a warning, got %+v", d)
+	}
+}
@@ -0,0 +1,64 @@
+// Package testutil provides fixtures shared by the tests of several packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitTag commits the files, keyed by their slash separated path, to the
+// git repository in dir, creating it if needed, and points the tag at the
+// commit, moving it if it exists. The files listed as executable are written
+// with mode 0755, all others with 0644.
+func CommitTag(t testing.TB, dir string, tag string, files map[string]string, executable ...string) {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.PlainInit(dir, false)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := map[string]os.FileMode{}
+	for _, name := range executable {
+		modes[name] = 0755
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		mode, ok := modes[name]
+		if !ok {
+			mode = 0644
+		}
+		if err := os.WriteFile(p, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	h, err := wt.Commit("update", &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Tag(tag); err == nil {
+		if err := repo.DeleteTag(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.CreateTag(tag, h, nil); err != nil {
+		t.Fatal(err)
+	}
+}
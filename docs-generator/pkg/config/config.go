@@ -1,29 +1,306 @@
 package config
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	defaultHost = "github.com"
+	defaultOrg  = "stackabletech"
+)
+
+var (
+	defaultInclude = []string{"deploy/helm/**/*.yaml"}
+	defaultMatch   = []string{`"?kind"?\s*:\s*"?CustomResourceDefinition`}
+	// defaultExamples is where the example custom resources of the
+	// documentation are kept
+	defaultExamples = []string{"docs/modules/**/examples/**/*.yaml"}
+	nightlyChannel  = Channel{Name: "nightly", Branch: "main"}
+	// defaultModifiers are applied to the CRDs of repos without configured
+	// modifiers
+	defaultModifiers = []Modifier{{Name: "stripLabels"}, {Name: "stripAnnotations"}, {Name: "stripConversion"}}
+)
+
 type Config struct {
-	Repos            map[string][]string `yaml:"repos"`
-	PlatformVersions []string            `yaml:"platformVersions"`
+	Source           Source          `yaml:"source"`
+	Discovery        Discovery       `yaml:"discovery"`
+	Helm             Helm            `yaml:"helm"`
+	Kustomize        Kustomize       `yaml:"kustomize"`
+	Examples         Examples        `yaml:"examples"`
+	Channels         []Channel       `yaml:"channels"`
+	Modifiers        []Modifier      `yaml:"modifiers"`
+	Lint             Lint            `yaml:"lint"`
+	Repos            map[string]Repo `yaml:"repos"`
+	PlatformVersions []string        `yaml:"platformVersions"`
+}
+
+// Discovery configures which files of a repo are searched for CRDs. Files
+// must match any include glob, no exclude glob and any of the content
+// patterns (regular expressions).
+type Discovery struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	Match   []string `yaml:"match"`
+}
+
+// Helm configures rendering of the Helm charts found in a repo. The charts
+// are rendered with their default values, overridden by the configured ones.
+type Helm struct {
+	Disabled bool                   `yaml:"disabled"`
+	Values   map[string]interface{} `yaml:"values"`
+}
+
+// Kustomize configures directories of a repo which are built with kustomize,
+// the output is searched for CRDs. Binary is either kustomize or kubectl.
+type Kustomize struct {
+	Binary string   `yaml:"binary"`
+	Dirs   []string `yaml:"dirs"`
+}
+
+// Examples configures which files of a repo are searched for example custom
+// resources, by include and exclude globs.
+type Examples struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Channel is a development branch which is indexed and documented like a
+// tag, under its name. The branch defaults to the name. Channels are listed
+// after all tags, in ascending order; the order defaults to the position in
+// the list.
+type Channel struct {
+	Name   string `yaml:"name"`
+	Branch string `yaml:"branch"`
+	Order  int    `yaml:"order"`
+}
+
+// Modifier selects a modifier which is applied to each CRD before it is
+// stored, by the name it is registered under in the crd package, with its
+// arguments.
+type Modifier struct {
+	Name string   `yaml:"name"`
+	Args []string `yaml:"args"`
+}
+
+// String returns the name and the arguments, e.g. dropFields(status).
+func (m Modifier) String() string {
+	if len(m.Args) == 0 {
+		return m.Name
+	}
+	return fmt.Sprintf("%s(%s)", m.Name, strings.Join(m.Args, ", "))
+}
+
+// Lint configures the CRD linter. Rules maps rule names to the severity of
+// their issues, off disables a rule. Runs fail if any issue is at least as
+// severe as FailOn, unless it is empty.
+type Lint struct {
+	Rules  map[string]string `yaml:"rules"`
+	FailOn string            `yaml:"failOn"`
+}
+
+// Source describes where a repository is cloned from. Either a full URL is
+// given, or the URL is built from host, organization and repository name.
+type Source struct {
+	URL  string `yaml:"url"`
+	Host string `yaml:"host"`
+	Org  string `yaml:"org"`
+}
+
+// Repo is the configuration of a single repository. In the config file it is
+// either given as a plain list of tags or as a mapping with the source and
+// tags. If a local path (a directory or a tar archive) is given, it is used
+// instead of cloning, and the tags are pseudo-tags to store its CRDs under.
+// Tags may also be patterns, see ResolveTags.
+type Repo struct {
+	Source        `yaml:",inline"`
+	Path          string     `yaml:"path"`
+	Tags          []string   `yaml:"tags"`
+	LatestPatches int        `yaml:"latestPatches"`
+	Discovery     *Discovery `yaml:"discovery"`
+	Helm          *Helm      `yaml:"helm"`
+	Kustomize     *Kustomize `yaml:"kustomize"`
+	Examples      *Examples  `yaml:"examples"`
+	Channels      []Channel  `yaml:"channels"`
+	Modifiers     []Modifier `yaml:"modifiers"`
+	Lint          *Lint      `yaml:"lint"`
+}
+
+func (r *Repo) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var tags []string
+	if err := unmarshal(&tags); err == nil {
+		r.Tags = tags
+		return nil
+	}
+	type plain Repo
+	return unmarshal((*plain)(r))
 }
 
 func (c *Config) NewConfigFromFile(filePath string) error {
 	yamlFile, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Fatalf("Error reading YAML file %s: %v", filePath, err)
-		return err
+		return fmt.Errorf("error reading YAML file %s: %w", filePath, err)
 	}
 
 	err = yaml.Unmarshal(yamlFile, c)
 	if err != nil {
-		log.Fatalf("Error unmarshalling YAML: %v", err)
-		return err
+		return fmt.Errorf("error unmarshalling YAML: %w", err)
+	}
+
+	return nil
+}
+
+// RepoURL returns the URL the named repo should be cloned from. A URL
+// configured for the repo wins, otherwise the URL is built from the host and
+// organization, where the repo settings override the global defaults.
+func (c *Config) RepoURL(name string) string {
+	repo := c.Repos[name]
+	if repo.URL != "" {
+		return repo.URL
 	}
+	host := firstNonEmpty(repo.Host, c.Source.Host, defaultHost)
+	org := firstNonEmpty(repo.Org, c.Source.Org, defaultOrg)
+	if c.Source.URL != "" && repo.Host == "" && repo.Org == "" {
+		// a global URL acts as the base all repos are located under
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(c.Source.URL, "/"), name)
+	}
+	return fmt.Sprintf("https://%s/%s/%s", host, org, name)
+}
+
+// RepoDiscovery returns the discovery settings for the named repo. Each field
+// set for the repo replaces the global one, unset fields fall back to the
+// global settings and then to the defaults.
+func (c *Config) RepoDiscovery(name string) Discovery {
+	d := Discovery{
+		Include: firstNonEmptyList(c.Discovery.Include, defaultInclude),
+		Exclude: c.Discovery.Exclude,
+		Match:   firstNonEmptyList(c.Discovery.Match, defaultMatch),
+	}
+	if r := c.Repos[name].Discovery; r != nil {
+		d.Include = firstNonEmptyList(r.Include, d.Include)
+		d.Exclude = firstNonEmptyList(r.Exclude, d.Exclude)
+		d.Match = firstNonEmptyList(r.Match, d.Match)
+	}
+	return d
+}
+
+// RepoHelm returns the Helm settings for the named repo. Settings given for
+// the repo replace the global ones.
+func (c *Config) RepoHelm(name string) Helm {
+	if r := c.Repos[name].Helm; r != nil {
+		return *r
+	}
+	return c.Helm
+}
 
+// RepoKustomize returns the kustomize settings for the named repo. Each
+// field set for the repo replaces the global one.
+func (c *Config) RepoKustomize(name string) Kustomize {
+	k := c.Kustomize
+	if r := c.Repos[name].Kustomize; r != nil {
+		k.Binary = firstNonEmpty(r.Binary, k.Binary)
+		k.Dirs = firstNonEmptyList(r.Dirs, k.Dirs)
+	}
+	return k
+}
+
+// RepoExamples returns the example settings for the named repo. Each field
+// set for the repo replaces the global one, the include globs fall back to
+// the defaults.
+func (c *Config) RepoExamples(name string) Examples {
+	e := Examples{
+		Include: firstNonEmptyList(c.Examples.Include, defaultExamples),
+		Exclude: c.Examples.Exclude,
+	}
+	if r := c.Repos[name].Examples; r != nil {
+		e.Include = firstNonEmptyList(r.Include, e.Include)
+		e.Exclude = firstNonEmptyList(r.Exclude, e.Exclude)
+	}
+	return e
+}
+
+// RepoChannels returns the channels of the named repo. Channels configured
+// for the repo replace the global ones. For compatibility, a `nightly` entry
+// in the tags is the channel of the main branch, unless a channel of that
+// name is configured.
+func (c *Config) RepoChannels(name string) []Channel {
+	configured := c.Repos[name].Channels
+	if len(configured) == 0 {
+		configured = c.Channels
+	}
+	channels := make([]Channel, 0, len(configured)+1)
+	names := map[string]bool{}
+	for i, ch := range configured {
+		if ch.Branch == "" {
+			ch.Branch = ch.Name
+		}
+		if ch.Order == 0 {
+			ch.Order = i + 1
+		}
+		names[ch.Name] = true
+		channels = append(channels, ch)
+	}
+	for _, t := range c.Repos[name].Tags {
+		if t == nightlyChannel.Name && !names[t] {
+			ch := nightlyChannel
+			ch.Order = len(channels) + 1
+			channels = append(channels, ch)
+		}
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Order < channels[j].Order
+	})
+	return channels
+}
+
+// RepoModifiers returns the modifiers applied to the CRDs of the named repo,
+// in order. Modifiers configured for the repo replace the global ones, which
+// default to stripping labels, annotations and conversion.
+func (c *Config) RepoModifiers(name string) []Modifier {
+	if m := c.Repos[name].Modifiers; len(m) > 0 {
+		return m
+	}
+	if len(c.Modifiers) > 0 {
+		return c.Modifiers
+	}
+	return defaultModifiers
+}
+
+// RepoLint returns the lint settings for the named repo. Rules configured for
+// the repo override the global severity of the same rule, a failOn set for
+// the repo replaces the global one.
+func (c *Config) RepoLint(name string) Lint {
+	l := Lint{Rules: map[string]string{}, FailOn: c.Lint.FailOn}
+	for rule, severity := range c.Lint.Rules {
+		l.Rules[rule] = severity
+	}
+	if r := c.Repos[name].Lint; r != nil {
+		for rule, severity := range r.Rules {
+			l.Rules[rule] = severity
+		}
+		l.FailOn = firstNonEmpty(r.FailOn, l.FailOn)
+	}
+	return l
+}
+
+func firstNonEmptyList(values ...[]string) []string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
 	return nil
 }
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var sources = []byte(`
+source:
+  org: myorg
+repos:
+  airflow-operator:
+    - "23.7.0"
+  druid-operator:
+    org: otherorg
+    tags:
+      - "23.4.0"
+  fork-operator:
+    url: https://gitea.example.com/me/fork-operator.git
+    tags:
+      - "nightly"
+  local-operator:
+    url: file:///tmp/repos/local-operator
+`)
+
+func TestRepoURL(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(sources, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	cases := []struct {
+		repo string
+		url  string
+		tags int
+	}{
+		{repo: "airflow-operator", url: "https://github.com/myorg/airflow-operator", tags: 1},
+		{repo: "druid-operator", url: "https://github.com/otherorg/druid-operator", tags: 1},
+		{repo: "fork-operator", url: "https://gitea.example.com/me/fork-operator.git", tags: 1},
+		{repo: "local-operator", url: "file:///tmp/repos/local-operator", tags: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.repo, func(t *testing.T) {
+			if url := c.RepoURL(tc.repo); url != tc.url {
+				t.Errorf("Unexpected URL: %s, expected %s", url, tc.url)
+			}
+			if tags := len(c.Repos[tc.repo].Tags); tags != tc.tags {
+				t.Errorf("Unexpected number of tags: %d, expected %d", tags, tc.tags)
+			}
+		})
+	}
+}
+
+func TestRepoURLBase(t *testing.T) {
+	c := Config{
+		Source: Source{URL: "file:///tmp/repos/"},
+		Repos:  map[string]Repo{"airflow-operator": {}},
+	}
+	if url := c.RepoURL("airflow-operator"); url != "file:///tmp/repos/airflow-operator" {
+		t.Errorf("Unexpected URL: %s", url)
+	}
+}
+
+var discovery = []byte(`
+discovery:
+  exclude:
+    - "**/templates/**"
+repos:
+  airflow-operator:
+    - "23.7.0"
+  extra-operator:
+    discovery:
+      include:
+        - "extra/crds.yaml"
+        - "deploy/crd/**/*.yml"
+    tags:
+      - "23.7.0"
+`)
+
+func TestRepoDiscovery(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(discovery, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	d := c.RepoDiscovery("airflow-operator")
+	if len(d.Include) != 1 || d.Include[0] != defaultInclude[0] {
+		t.Errorf("Expected default include, got %v", d.Include)
+	}
+	if len(d.Exclude) != 1 || len(d.Match) != 1 {
+		t.Errorf("Expected global exclude and default match, got %v, %v", d.Exclude, d.Match)
+	}
+
+	d = c.RepoDiscovery("extra-operator")
+	if len(d.Include) != 2 || d.Include[0] != "extra/crds.yaml" {
+		t.Errorf("Expected repo include, got %v", d.Include)
+	}
+	if len(d.Exclude) != 1 {
+		t.Errorf("Expected global exclude, got %v", d.Exclude)
+	}
+}
+
+var channels = []byte(`
+channels:
+  - name: dev
+    branch: main
+  - name: "24.3-dev"
+    branch: release-24.3
+    order: 5
+repos:
+  airflow-operator:
+    - "23.7.0"
+    - "nightly"
+  druid-operator:
+    channels:
+      - name: nightly
+        branch: develop
+    tags:
+      - "23.7.0"
+      - "nightly"
+`)
+
+func TestRepoChannels(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(channels, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	got := c.RepoChannels("airflow-operator")
+	want := []Channel{
+		{Name: "dev", Branch: "main", Order: 1},
+		{Name: "nightly", Branch: "main", Order: 3},
+		{Name: "24.3-dev", Branch: "release-24.3", Order: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected global channels and nightly, got %v", got)
+	}
+
+	got = c.RepoChannels("druid-operator")
+	want = []Channel{{Name: "nightly", Branch: "develop", Order: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected repo channel, got %v", got)
+	}
+}
+
+var examples = []byte(`
+examples:
+  exclude:
+    - "**/*.j2"
+repos:
+  airflow-operator:
+    - "23.7.0"
+  extra-operator:
+    examples:
+      include:
+        - "tests/templates/**/*.yaml"
+    tags:
+      - "23.7.0"
+`)
+
+func TestRepoExamples(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(examples, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	e := c.RepoExamples("airflow-operator")
+	if !reflect.DeepEqual(e.Include, defaultExamples) || len(e.Exclude) != 1 {
+		t.Errorf("Expected default include and global exclude, got %v, %v", e.Include, e.Exclude)
+	}
+
+	e = c.RepoExamples("extra-operator")
+	if len(e.Include) != 1 || e.Include[0] != "tests/templates/**/*.yaml" || len(e.Exclude) != 1 {
+		t.Errorf("Expected repo include and global exclude, got %v, %v", e.Include, e.Exclude)
+	}
+}
+
+var modifiers = []byte(`
+modifiers:
+  - name: stripLabels
+  - name: keepAnnotations
+    args:
+      - "helm.sh/*"
+repos:
+  airflow-operator:
+    - "23.7.0"
+  extra-operator:
+    modifiers:
+      - name: dropFields
+        args:
+          - status
+          - spec.internal
+    tags:
+      - "1.0.0"
+`)
+
+func TestRepoModifiers(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(modifiers, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	m := c.RepoModifiers("airflow-operator")
+	if len(m) != 2 || m[1].String() != "keepAnnotations(helm.sh/*)" {
+		t.Errorf("Expected the global modifiers, got %v", m)
+	}
+
+	m = c.RepoModifiers("extra-operator")
+	if len(m) != 1 || m[0].String() != "dropFields(status, spec.internal)" {
+		t.Errorf("Expected the repo modifiers, got %v", m)
+	}
+
+	c.Modifiers = nil
+	m = c.RepoModifiers("airflow-operator")
+	if !reflect.DeepEqual(m, defaultModifiers) {
+		t.Errorf("Expected the default modifiers, got %v", m)
+	}
+}
+
+var lint = []byte(`
+lint:
+  failOn: error
+  rules:
+    missing-description: "off"
+    camel-case: error
+repos:
+  airflow-operator:
+    - "23.7.0"
+  extra-operator:
+    lint:
+      failOn: warning
+      rules:
+        camel-case: warning
+    tags:
+      - "23.7.0"
+`)
+
+func TestRepoLint(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal(lint, &c); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	l := c.RepoLint("airflow-operator")
+	expected := Lint{Rules: map[string]string{"missing-description": "off", "camel-case": "error"}, FailOn: "error"}
+	if !reflect.DeepEqual(l, expected) {
+		t.Errorf("Expected the global lint settings, got %v", l)
+	}
+
+	l = c.RepoLint("extra-operator")
+	expected = Lint{Rules: map[string]string{"missing-description": "off", "camel-case": "warning"}, FailOn: "warning"}
+	if !reflect.DeepEqual(l, expected) {
+		t.Errorf("Expected the merged lint settings, got %v", l)
+	}
+	if c.Lint.Rules["camel-case"] != "error" {
+		t.Errorf("Expected the global rules to be unchanged, got %v", c.Lint.Rules)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// ResolvedTag is a tag selected by an entry of the tags of a repo.
+type ResolvedTag struct {
+	Name string
+	// Selector is the config entry which selected the tag.
+	Selector string
+}
+
+// IsTagPattern returns true if a tags entry is a pattern rather than the
+// name of a single tag. Patterns are globs (`23.*`) and semver ranges
+// (`>=23.4.0`, `>=23.4.0 <24.0.0`, `>=1.0.0 || 0.9.x`, `23.4.x`).
+func IsTagPattern(entry string) bool {
+	return entry != "" && (isGlob(entry) || isRange(entry))
+}
+
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// isRange returns true for entries starting with a comparison and for
+// versions with an `x` wildcard segment.
+func isRange(entry string) bool {
+	if entry == "" {
+		return false
+	}
+	if strings.ContainsAny(entry[:1], "<>=!") {
+		return true
+	}
+	for _, v := range strings.Fields(entry) {
+		segments := strings.Split(v, ".")
+		if len(segments) < 2 {
+			continue
+		}
+		for _, s := range segments {
+			if s == "x" || s == "X" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasTagPatterns returns true if any of the tags entries of the repo is a
+// pattern, in which case the available tags need to be listed to resolve
+// them.
+func (r Repo) HasTagPatterns() bool {
+	for _, t := range r.Tags {
+		if t != "" && IsTagPattern(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTags resolves the tags entries of the repo against the available
+// tags. Plain tag names are kept as they are, patterns select all matching
+// available tags. If LatestPatches is set, patterns only select that many of
+// the latest patch releases of each minor release. Pre-releases are never
+// selected by semver ranges. The result is sorted by descending version.
+func (r Repo) ResolveTags(available []string) ([]ResolvedTag, error) {
+	selected := map[string]string{}
+	for _, entry := range r.Tags {
+		if entry == "" {
+			continue
+		}
+		if !IsTagPattern(entry) {
+			selected[entry] = entry
+			continue
+		}
+		matches, err := matchTags(entry, available)
+		if err != nil {
+			return nil, err
+		}
+		if r.LatestPatches > 0 {
+			matches = latestPatches(matches, r.LatestPatches)
+		}
+		for _, m := range matches {
+			if _, ok := selected[m]; !ok {
+				selected[m] = entry
+			}
+		}
+	}
+	resolved := make([]ResolvedTag, 0, len(selected))
+	for name, selector := range selected {
+		resolved = append(resolved, ResolvedTag{Name: name, Selector: selector})
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return tagLess(resolved[j].Name, resolved[i].Name)
+	})
+	return resolved, nil
+}
+
+func matchTags(pattern string, available []string) ([]string, error) {
+	var matches []string
+	if isGlob(pattern) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		}
+		for _, t := range available {
+			if ok, _ := path.Match(pattern, t); ok {
+				matches = append(matches, t)
+			}
+		}
+		return matches, nil
+	}
+	// the semver package only knows lower case wildcards
+	r, err := semver.ParseRange(strings.ReplaceAll(pattern, ".X", ".x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag range %q: %w", pattern, err)
+	}
+	for _, t := range available {
+		v, err := semver.ParseTolerant(t)
+		if err != nil || len(v.Pre) > 0 {
+			continue
+		}
+		if r(v) {
+			matches = append(matches, t)
+		}
+	}
+	return matches, nil
+}
+
+// latestPatches keeps the n latest patch releases of each minor release.
+// Tags which are no semantic versions are kept.
+func latestPatches(tags []string, n int) []string {
+	byMinor := map[string][]string{}
+	var kept []string
+	for _, t := range tags {
+		v, err := semver.ParseTolerant(t)
+		if err != nil {
+			kept = append(kept, t)
+			continue
+		}
+		minor := fmt.Sprintf("%d.%d", v.Major, v.Minor)
+		byMinor[minor] = append(byMinor[minor], t)
+	}
+	for _, patches := range byMinor {
+		sort.Slice(patches, func(i, j int) bool {
+			return tagLess(patches[j], patches[i])
+		})
+		if len(patches) > n {
+			patches = patches[:n]
+		}
+		kept = append(kept, patches...)
+	}
+	return kept
+}
+
+// tagLess orders tags by semantic version, tags which are no semantic
+// versions are ordered by name before all versions.
+func tagLess(a string, b string) bool {
+	va, errA := semver.ParseTolerant(a)
+	vb, errB := semver.ParseTolerant(b)
+	switch {
+	case errA != nil && errB != nil:
+		return a < b
+	case errA != nil:
+		return true
+	case errB != nil:
+		return false
+	case va.EQ(vb):
+		return a < b
+	}
+	return va.LT(vb)
+}
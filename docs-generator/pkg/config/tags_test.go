@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+var available = []string{"23.1.0", "23.4.0", "23.4.1", "23.7.0", "23.7.1-rc1", "23.11.0", "24.3.0", "main"}
+
+func TestResolveTags(t *testing.T) {
+	tests := []struct {
+		tags          []string
+		latestPatches int
+		want          []string
+	}{
+		{[]string{"23.7.0", "nightly"}, 0, []string{"23.7.0", "nightly"}},
+		{[]string{"23.4.*"}, 0, []string{"23.4.1", "23.4.0"}},
+		{[]string{">=23.7.0 <24.0.0"}, 0, []string{"23.11.0", "23.7.0"}},
+		{[]string{"23.4.x"}, 0, []string{"23.4.1", "23.4.0"}},
+		{[]string{"23.X"}, 1, []string{"23.11.0", "23.7.0", "23.4.1", "23.1.0"}},
+		{[]string{">=23.4.0"}, 1, []string{"24.3.0", "23.11.0", "23.7.0", "23.4.1"}},
+		{[]string{"23.*", "23.4.0"}, 0, []string{"23.11.0", "23.7.1-rc1", "23.7.0", "23.4.1", "23.4.0", "23.1.0"}},
+	}
+	for _, tt := range tests {
+		r := Repo{Tags: tt.tags, LatestPatches: tt.latestPatches}
+		resolved, err := r.ResolveTags(available)
+		if err != nil {
+			t.Errorf("Failed to resolve %v: %s", tt.tags, err)
+			continue
+		}
+		var got []string
+		for _, tag := range resolved {
+			got = append(got, tag.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolving %v: expected %v, got %v", tt.tags, tt.want, got)
+		}
+	}
+}
+
+func TestResolveTagsSelector(t *testing.T) {
+	r := Repo{Tags: []string{"23.4.0", "23.4.*"}}
+	resolved, err := r.ResolveTags(available)
+	if err != nil {
+		t.Fatalf("Failed to resolve tags: %s", err)
+	}
+	for _, tag := range resolved {
+		want := "23.4.*"
+		if tag.Name == "23.4.0" {
+			want = "23.4.0"
+		}
+		if tag.Selector != want {
+			t.Errorf("Expected %s to be selected by %s, got %s", tag.Name, want, tag.Selector)
+		}
+	}
+}
+
+func TestResolveTagsInvalid(t *testing.T) {
+	r := Repo{Tags: []string{">=foo"}}
+	if _, err := r.ResolveTags(available); err == nil {
+		t.Errorf("Expected an invalid range to fail")
+	}
+}
+
+func TestIsTagPattern(t *testing.T) {
+	tests := map[string]bool{
+		"":                false,
+		"23.7.0":          false,
+		"nightly":         false,
+		"x":               false,
+		"23.4.*":          true,
+		">=23.4.0":        true,
+		"23.4.x":          true,
+		"23.X":            true,
+		"1.0.0 || 0.9.x":  true,
+		"release-23.4.x1": false,
+	}
+	for entry, want := range tests {
+		if got := IsTagPattern(entry); got != want {
+			t.Errorf("IsTagPattern(%q): expected %v, got %v", entry, want, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package crd
+
+import (
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// Coverage is how many properties of a schema are described.
+type Coverage struct {
+	Properties int `json:"properties"`
+	Described  int `json:"described"`
+}
+
+// Percent returns the percentage of described properties, 100 if there are
+// no properties.
+func (c Coverage) Percent() float64 {
+	if c.Properties == 0 {
+		return 100
+	}
+	return 100 * float64(c.Described) / float64(c.Properties)
+}
+
+// Add returns the coverage of both schemas together.
+func (c Coverage) Add(o Coverage) Coverage {
+	return Coverage{Properties: c.Properties + o.Properties, Described: c.Described + o.Described}
+}
+
+// DescriptionCoverage counts the named properties of a schema and those with
+// a non-empty description. The standard fields apiVersion, kind and metadata
+// are not counted, nor are array items and additional properties, which are
+// described by their property. Properties repeated in allOf, anyOf, oneOf or
+// not count once, as described if their first occurrence is.
+func DescriptionCoverage(s *apiextensions.JSONSchemaProps) Coverage {
+	var c Coverage
+	if s == nil {
+		return c
+	}
+	seen := map[string]bool{}
+	WalkSchema(s, func(path string, s *apiextensions.JSONSchemaProps) {
+		if seen[path] || !isDocumentedProperty(path) {
+			return
+		}
+		seen[path] = true
+		c.Properties++
+		if strings.TrimSpace(s.Description) != "" {
+			c.Described++
+		}
+	})
+	return c
+}
+
+func isDocumentedProperty(path string) bool {
+	switch {
+	case path == "", path == "*", strings.HasSuffix(path, "]"), strings.HasSuffix(path, ".*"):
+		return false
+	case path == "apiVersion", path == "kind", path == "metadata", strings.HasPrefix(path, "metadata."):
+		return false
+	}
+	return true
+}
@@ -39,6 +39,9 @@ const (
 	yamlToJSONErr            = "could not convert yaml to json"
 	getTypeMetaErr           = "could not get type metadata for crd instance"
 	wrongGVKErr              = "crd instance was not of correct group version kind"
+	versionNotDefinedErr     = "crd instance version is not defined by the crd"
+	versionNotServedErr      = "crd instance version is not served"
+	notV1Beta1Err            = "crd is not a v1beta1 crd"
 	instanceConversionErr    = "could not convert crd instance json to instance"
 )
 
@@ -46,13 +49,20 @@ const (
 type CRDer struct {
 	CRD *apiextensions.CustomResourceDefinition
 	GVK *schema.GroupVersionKind
+	// Warnings are the validation errors of a v1 CRD, which is accepted
+	// nonetheless.
+	Warnings []string
+	// deprecated maps deprecated versions to their deprecation warning.
+	deprecated map[string]string
 }
 
 // NewCRDer returns a new CRDer type.
 func NewCRDer(data []byte, m ...Modifier) (*CRDer, error) {
 	internal := &apiextensions.CustomResourceDefinition{}
+	var warnings []string
 	if errV1Beta1 := convertV1Beta1ToInternal(data, internal, m...); errV1Beta1 != nil {
-		if errV1 := convertV1ToInternal(data, internal, m...); errV1 != nil {
+		var errV1 error
+		if warnings, errV1 = convertV1ToInternal(data, internal, m...); errV1 != nil {
 			return nil, fmt.Errorf("conversion unsuccessful: %s, %s", errV1Beta1, errV1)
 		}
 	}
@@ -62,66 +72,137 @@ func NewCRDer(data []byte, m ...Modifier) (*CRDer, error) {
 		return nil, errors.New(getStoredGVKErr)
 	}
 
+	return &CRDer{CRD: internal, GVK: gvk, Warnings: warnings, deprecated: parseDeprecations(data)}, nil
+}
+
+// NewCRDerFromInternal returns a CRDer for a CRD which already is in the
+// internal representation, e.g. as stored in the database. Modifiers are not
+// applied again.
+func NewCRDerFromInternal(internal *apiextensions.CustomResourceDefinition) (*CRDer, error) {
+	gvk := GetStoredGVK(internal)
+	if gvk == nil {
+		return nil, errors.New(getStoredGVKErr)
+	}
+
 	return &CRDer{CRD: internal, GVK: gvk}, nil
 }
 
-// Validate returns true if CRD instance is valid.
+// Validate returns nil if the CRD instance is valid. If the instance does not
+// match the schema, the error is a *ValidationError.
 func (c *CRDer) Validate(data []byte) error {
-	sv := getStoredSchema(c.CRD.Spec)
+	res, err := c.ValidateDetailed(data)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
 
-	s, _, err := servervalidation.NewSchemaValidator(sv)
+// ValidateDetailed validates a CRD instance against the schema of the
+// version it declares, which may be any served version, and lists each field
+// which does not match the schema and each field which would be pruned. An
+// error is returned if the instance could not be validated at all, e.g.
+// because it is not of the kind of the CRD or its version is not served.
+func (c *CRDer) ValidateDetailed(data []byte) (*ValidationResult, error) {
+	instance, v, err := c.parseInstance(data)
 	if err != nil {
-		return errors.New(createSchemaValidatorErr)
+		return nil, err
 	}
 
+	s, _, err := servervalidation.NewSchemaValidator(VersionSchema(c.CRD, v.Name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", createSchemaValidatorErr, err)
+	}
+
+	res := &ValidationResult{}
+	if warning, deprecated := c.deprecated[v.Name]; deprecated {
+		if warning == "" {
+			warning = fmt.Sprintf("%s/%s is deprecated", c.GVK.Group, v.Name)
+		}
+		res.Warnings = append(res.Warnings, warning)
+	}
+	if res.Pruned, err = c.prunedFields(instance, v); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("could not determine pruned fields: %v", err))
+	}
+	errs := servervalidation.ValidateCustomResource(nil, instance, s)
+	res.Violations = newViolations(errs, data)
+	return res, nil
+}
+
+// parseInstance parses a CRD instance and returns it with the served version
+// it declares.
+func (c *CRDer) parseInstance(data []byte) (interface{}, apiextensions.CustomResourceDefinitionVersion, error) {
+	var v apiextensions.CustomResourceDefinitionVersion
 	j, err := yaml.YAMLToJSONStrict(data)
 	if err != nil {
-		return errors.New(yamlToJSONErr)
+		return nil, v, fmt.Errorf("%s: %w", yamlToJSONErr, err)
 	}
 
 	meta := &metav1.TypeMeta{}
 	if err := json.Unmarshal(j, meta); err != nil {
-		return errors.New(getTypeMetaErr)
+		return nil, v, fmt.Errorf("%s: %w", getTypeMetaErr, err)
 	}
 
-	if !isStoredGVK(meta, c.GVK) {
-		return errors.New(wrongGVKErr)
+	gvk := meta.GroupVersionKind()
+	if gvk.Group != c.GVK.Group || gvk.Kind != c.GVK.Kind {
+		return nil, v, errors.New(wrongGVKErr)
+	}
+	v, ok := c.version(gvk.Version)
+	if !ok {
+		return nil, v, fmt.Errorf("%s: %s", versionNotDefinedErr, meta.APIVersion)
+	}
+	if !v.Served {
+		return nil, v, fmt.Errorf("%s: %s", versionNotServedErr, meta.APIVersion)
 	}
 
 	var instance interface{}
 	if err := json.Unmarshal(j, &instance); err != nil {
-		return errors.New(instanceConversionErr)
+		return nil, v, fmt.Errorf("%s: %w", instanceConversionErr, err)
+	}
+	return instance, v, nil
+}
+
+// version returns the named version of the CRD.
+func (c *CRDer) version(name string) (apiextensions.CustomResourceDefinitionVersion, bool) {
+	for _, v := range c.CRD.Spec.Versions {
+		if v.Name == name {
+			return v, true
+		}
 	}
+	return apiextensions.CustomResourceDefinitionVersion{}, false
+}
 
-	res := servervalidation.ValidateCustomResource(nil, instance, s)
-	if len(res) > 0 {
-		return errors.New(res.ToAggregate().Error())
+// SetDeprecated marks a version as deprecated. The internal representation
+// has no deprecation fields, so this is needed for CRDs which were not
+// created from their original document.
+func (c *CRDer) SetDeprecated(version string, warning string) {
+	if c.deprecated == nil {
+		c.deprecated = map[string]string{}
 	}
-	return nil
+	c.deprecated[version] = warning
 }
 
-func convertV1ToInternal(data []byte, internal *apiextensions.CustomResourceDefinition, mods ...Modifier) error {
+// convertV1ToInternal converts a v1 CRD. Validation errors do not fail the
+// conversion, they are returned as warnings.
+func convertV1ToInternal(data []byte, internal *apiextensions.CustomResourceDefinition, mods ...Modifier) ([]string, error) {
 	crd := &v1.CustomResourceDefinition{}
 	if err := yaml.Unmarshal(data, crd); err != nil {
-		return err
+		return nil, err
 	}
 	v1.SetDefaults_CustomResourceDefinition(crd)
 	if err := v1.Convert_v1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(crd, internal, nil); err != nil {
-		return err
+		return nil, err
 	}
 	for _, m := range mods {
 		m(internal)
 	}
+	var warnings []string
 	errList := validation.ValidateCustomResourceDefinition(internal, v1.SchemeGroupVersion)
-	if len(errList) > 0 {
-		for _, e := range errList {
-			log.Printf("WARNING: %v", e)
-		}
-		// Do not raise an error, we just print the validation results.
-		// return errors.New(errList.ToAggregate().Error())
+	for _, e := range errList {
+		log.Printf("WARNING: %v", e)
+		warnings = append(warnings, e.Error())
 	}
 
-	return nil
+	return warnings, nil
 }
 
 func convertV1Beta1ToInternal(data []byte, internal *apiextensions.CustomResourceDefinition, mods ...Modifier) error {
@@ -129,6 +210,11 @@ func convertV1Beta1ToInternal(data []byte, internal *apiextensions.CustomResourc
 	if err := yaml.Unmarshal(data, crd); err != nil {
 		return err
 	}
+	// v1 CRDs often are valid v1beta1 CRDs as well, but they are defaulted
+	// differently, e.g. v1beta1 CRDs preserve unknown fields
+	if crd.APIVersion != "" && crd.APIVersion != v1beta1.SchemeGroupVersion.String() {
+		return fmt.Errorf("%s: %s", notV1Beta1Err, crd.APIVersion)
+	}
 	v1beta1.SetObjectDefaults_CustomResourceDefinition(crd)
 	if err := v1beta1.Convert_v1beta1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(crd, internal, nil); err != nil {
 		return err
@@ -144,18 +230,6 @@ func convertV1Beta1ToInternal(data []byte, internal *apiextensions.CustomResourc
 	return nil
 }
 
-func getStoredSchema(spec apiextensions.CustomResourceDefinitionSpec) *apiextensions.CustomResourceValidation {
-	if spec.Validation != nil {
-		return spec.Validation
-	}
-	for _, v := range spec.Versions {
-		if v.Storage {
-			return v.Schema
-		}
-	}
-	return nil
-}
-
 func GetStoredGVK(crd *apiextensions.CustomResourceDefinition) *schema.GroupVersionKind {
 	for _, v := range crd.Spec.Versions {
 		if v.Storage {
@@ -170,14 +244,6 @@ func GetStoredGVK(crd *apiextensions.CustomResourceDefinition) *schema.GroupVers
 	return nil
 }
 
-func isStoredGVK(meta *metav1.TypeMeta, gvk *schema.GroupVersionKind) bool {
-	if meta.GroupVersionKind() == *gvk {
-		return true
-	}
-
-	return false
-}
-
 // A Modifier specifies how to modify a CRD prior to conversion to internal
 // representation
 type Modifier func(crd *apiextensions.CustomResourceDefinition)
@@ -17,7 +17,13 @@ limitations under the License.
 package crd
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 )
 
 var _ Modifier = StripLabels()
@@ -381,3 +387,601 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+var v1NoSchema = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    additionalPrinterColumns:
+    - name: Spec
+      type: string
+      jsonPath: .spec.cronSpec
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestWarnings(t *testing.T) {
+	c, err := NewCRDer(v1NoSchema)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if len(c.Warnings) == 0 {
+		t.Errorf("Expected warnings for a v1 CRD without schema")
+	}
+
+	c, err = NewCRDer(v1beta1crd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if len(c.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", c.Warnings)
+	}
+}
+
+var v1deprecated = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1alpha1
+    served: false
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+  - name: v1beta1
+    served: true
+    storage: false
+    deprecated: true
+    deprecationWarning: "example.com/v1beta1 CronTab is deprecated"
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          host:
+            type: string
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          hostPort:
+            type: string
+  scope: Namespaced
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+`)
+
+func TestVersions(t *testing.T) {
+	c, err := NewCRDer(v1deprecated)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	versions := c.Versions()
+	if len(versions) != 2 {
+		t.Fatalf("Expected the served versions, got %v", versions)
+	}
+	if v := versions[0]; v.Name != "v1" || !v.Storage || v.Deprecated {
+		t.Errorf("Expected v1 storage version first, got %+v", v)
+	}
+	if v := versions[1]; v.Name != "v1beta1" || v.Storage || !v.Deprecated || v.DeprecationWarning == "" {
+		t.Errorf("Expected deprecated v1beta1, got %+v", v)
+	}
+
+	s := VersionSchema(c.CRD, "v1beta1")
+	if s == nil || s.OpenAPIV3Schema == nil {
+		t.Fatalf("Expected a schema for v1beta1")
+	}
+	if _, ok := s.OpenAPIV3Schema.Properties["host"]; !ok {
+		t.Errorf("Expected the schema of v1beta1, got %v", s.OpenAPIV3Schema.Properties)
+	}
+}
+
+var v1metadata = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.example.com
+spec:
+  group: example.com
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+    subresources:
+      status: {}
+      scale:
+        specReplicasPath: .spec.replicas
+        statusReplicasPath: .status.replicas
+    additionalPrinterColumns:
+    - name: Spec
+      type: string
+      jsonPath: .spec.cronSpec
+  - name: v1beta1
+    served: true
+    storage: false
+    schema:
+      openAPIV3Schema:
+        type: object
+  scope: Cluster
+  names:
+    plural: crontabs
+    singular: crontab
+    kind: CronTab
+    shortNames:
+    - ct
+    categories:
+    - all
+`)
+
+func TestValidateServedVersions(t *testing.T) {
+	c, err := NewCRDer(v1deprecated)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	instance := func(version string, field string) []byte {
+		return []byte("apiVersion: example.com/" + version + "\nkind: CronTab\nmetadata:\n  name: x\n" + field + ": 1\n")
+	}
+
+	// each version is validated against its own schema
+	res, err := c.ValidateDetailed(instance("v1beta1", "host"))
+	if err != nil {
+		t.Fatalf("Failed to validate v1beta1: %s", err)
+	}
+	if len(res.Violations) != 1 || res.Violations[0].Path != "host" {
+		t.Errorf("Expected host to be invalid in v1beta1, got %+v", res.Violations)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0] != "example.com/v1beta1 CronTab is deprecated" {
+		t.Errorf("Expected the deprecation warning, got %v", res.Warnings)
+	}
+	res, err = c.ValidateDetailed(instance("v1", "host"))
+	if err != nil {
+		t.Fatalf("Failed to validate v1: %s", err)
+	}
+	if !res.Valid() || len(res.Warnings) != 0 {
+		t.Errorf("Expected v1 to be valid without warnings, got %+v", res)
+	}
+
+	if _, err := c.ValidateDetailed(instance("v1alpha1", "host")); err == nil || !strings.Contains(err.Error(), versionNotServedErr) {
+		t.Errorf("Expected v1alpha1 not to be served, got %v", err)
+	}
+	if _, err := c.ValidateDetailed(instance("v2", "host")); err == nil || !strings.Contains(err.Error(), versionNotDefinedErr) {
+		t.Errorf("Expected v2 not to be defined, got %v", err)
+	}
+}
+
+func TestVersionMetadata(t *testing.T) {
+	c, err := NewCRDer(v1metadata)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	m := VersionMetadata(c.CRD, "v1")
+	if m.Scope != "Cluster" || len(m.ShortNames) != 1 || m.ShortNames[0] != "ct" || len(m.Categories) != 1 {
+		t.Errorf("Unexpected names: %+v", m)
+	}
+	if len(m.PrinterColumns) != 1 || m.PrinterColumns[0].JSONPath != ".spec.cronSpec" {
+		t.Errorf("Unexpected printer columns: %+v", m.PrinterColumns)
+	}
+	if len(m.Subresources) != 2 || m.Scale == nil || m.Scale.SpecReplicasPath != ".spec.replicas" {
+		t.Errorf("Unexpected subresources: %v %+v", m.Subresources, m.Scale)
+	}
+
+	m = VersionMetadata(c.CRD, "v1beta1")
+	if len(m.PrinterColumns) != 0 || len(m.Subresources) != 0 {
+		t.Errorf("Expected no printer columns and subresources for v1beta1, got %+v", m)
+	}
+}
+
+func TestNewCRDerFromInternal(t *testing.T) {
+	c, err := NewCRDer(crossplane)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	b, err := json.Marshal(c.CRD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal := &apiextensions.CustomResourceDefinition{}
+	if err := json.Unmarshal(b, internal); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := NewCRDerFromInternal(internal)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer from internal CRD: %s", err)
+	}
+	if *stored.GVK != *c.GVK {
+		t.Errorf("Expected GVK %v, got %v", c.GVK, stored.GVK)
+	}
+	if err := stored.Validate(b); err == nil {
+		t.Errorf("Expected the CRD itself to be invalid")
+	}
+	if err := stored.Validate(a); err == nil {
+		t.Errorf("Expected an instance of another CRD to be invalid")
+	}
+}
+
+var v1servers = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: servers.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    plural: servers
+    kind: Server
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - image
+            properties:
+              image:
+                type: string
+              ports:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+                    port:
+                      type: integer
+`)
+
+var invalidServer = []byte(`apiVersion: example.com/v1
+kind: Server
+metadata:
+  name: web
+spec:
+  ports:
+  - name: web
+  - port: http
+`)
+
+func TestValidateDetailed(t *testing.T) {
+	c, err := NewCRDer(v1servers)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	res, err := c.ValidateDetailed(invalidServer)
+	if err != nil {
+		t.Fatalf("Failed to validate: %s", err)
+	}
+	if res.Valid() {
+		t.Fatalf("Expected violations")
+	}
+	expected := map[string]Violation{
+		"spec.ports[1].port": {Type: "FieldValueInvalid", Value: "http", Line: 8, Column: 5},
+		"spec.image":         {Type: "FieldValueRequired", Line: 5, Column: 1},
+	}
+	for _, v := range res.Violations {
+		e, ok := expected[v.Path]
+		if !ok {
+			t.Errorf("Unexpected violation %+v", v)
+			continue
+		}
+		if v.Type != e.Type || v.Line != e.Line || v.Column != e.Column {
+			t.Errorf("Expected %s to be %s at %d:%d, got %+v", v.Path, e.Type, e.Line, e.Column, v)
+		}
+		if e.Value != nil && v.Value != e.Value {
+			t.Errorf("Expected value %v for %s, got %v", e.Value, v.Path, v.Value)
+		}
+		delete(expected, v.Path)
+	}
+	if len(expected) > 0 {
+		t.Errorf("Missing violations %v", expected)
+	}
+
+	err = c.Validate(invalidServer)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != len(res.Violations) {
+		t.Errorf("Expected a ValidationError, got %v", err)
+	}
+
+	if _, err := c.ValidateDetailed([]byte("kind: [")); err == nil {
+		t.Errorf("Expected an error for invalid YAML")
+	}
+}
+
+var v1defaults = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusters.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    plural: clusters
+    kind: Cluster
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              replicas:
+                type: integer
+                default: 1
+              logging:
+                type: object
+                default:
+                  level: info
+                properties:
+                  level:
+                    type: string
+              servers:
+                type: array
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+                    port:
+                      type: integer
+                      default: 8080
+`)
+
+var cluster = []byte(`apiVersion: example.com/v1
+kind: Cluster
+metadata:
+  name: simple
+spec:
+  servers:
+  - name: a
+  - name: b
+    port: 9090
+`)
+
+func TestDefault(t *testing.T) {
+	c, err := NewCRDer(v1defaults)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	res, err := c.Default(cluster)
+	if err != nil {
+		t.Fatalf("Failed to default: %s", err)
+	}
+	expected := []string{"spec.logging", "spec.replicas", "spec.servers[0].port"}
+	if !reflect.DeepEqual(res.Defaulted, expected) {
+		t.Errorf("Expected defaulted fields %v, got %v", expected, res.Defaulted)
+	}
+	y, err := res.YAML()
+	if err != nil {
+		t.Fatalf("Failed to write YAML: %s", err)
+	}
+	for _, line := range []string{
+		"replicas: 1 # defaulted",
+		"port: 8080 # defaulted",
+		"port: 9090\n",
+		"level: info\n",
+	} {
+		if !strings.Contains(string(y), line) {
+			t.Errorf("Expected %q in the defaulted YAML:\n%s", line, y)
+		}
+	}
+}
+
+var v1pruning = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusters.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    plural: clusters
+    kind: Cluster
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`)
+
+var typos = []byte(`apiVersion: example.com/v1
+kind: Cluster
+metadata:
+  name: typos
+  labels:
+    app: x
+extra: true
+spec:
+  sise: 3
+  config:
+    anything: goes
+`)
+
+func TestPrunedFields(t *testing.T) {
+	c, err := NewCRDer(v1pruning)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	pruned, err := c.PrunedFields(typos)
+	if err != nil {
+		t.Fatalf("Failed to prune: %s", err)
+	}
+	expected := []string{"extra", "spec.sise"}
+	if !reflect.DeepEqual(pruned, expected) {
+		t.Errorf("Expected pruned fields %v, got %v", expected, pruned)
+	}
+	res, err := c.ValidateDetailed(typos)
+	if err != nil {
+		t.Fatalf("Failed to validate: %s", err)
+	}
+	if !res.Valid() || !reflect.DeepEqual(res.Pruned, expected) {
+		t.Errorf("Expected a valid instance with pruned fields %v, got %+v", expected, res)
+	}
+
+	// this v1beta1 CRD does not preserve unknown fields, hostPort is an
+	// object in v1beta1 and unknown in v1
+	c, err = NewCRDer(v1beta1crd)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	pruned, err = c.PrunedFields(a)
+	if err != nil {
+		t.Fatalf("Failed to prune: %s", err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"hostPort"}) {
+		t.Errorf("Expected hostPort to be pruned, got %v", pruned)
+	}
+
+	// v1beta1 CRDs preserve unknown fields by default
+	c, err = NewCRDer(crossplane)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	pruned, err = c.PrunedFields(append(b, "unknown: true\n"...))
+	if err != nil {
+		t.Fatalf("Failed to prune: %s", err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("Expected nothing to be pruned, got %v", pruned)
+	}
+}
+
+func TestNewModifier(t *testing.T) {
+	if _, err := NewModifier("stripLabels", nil); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if _, err := NewModifier("stripLabels", []string{"x"}); err == nil {
+		t.Errorf("Expected an error for arguments of a modifier without arguments")
+	}
+	if _, err := NewModifier("dropFields", nil); err == nil {
+		t.Errorf("Expected an error for dropFields without fields")
+	}
+	if _, err := NewModifier("doesNotExist", nil); err == nil || !strings.Contains(err.Error(), "stripConversion") {
+		t.Errorf("Expected an error listing the available modifiers, got %v", err)
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	drop, err := NewModifier("dropFields", []string{"spec.image", "spec.ports[*].name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCRDer(v1servers, drop)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	spec := VersionSchema(c.CRD, "v1").OpenAPIV3Schema.Properties["spec"]
+	if _, ok := spec.Properties["image"]; ok || len(spec.Required) != 0 {
+		t.Errorf("Expected spec.image to be dropped, got %v, required %v", spec.Properties, spec.Required)
+	}
+	item := spec.Properties["ports"].Items.Schema
+	if _, ok := item.Properties["name"]; ok || len(item.Properties) != 1 {
+		t.Errorf("Expected only spec.ports[*].name to be dropped, got %v", item.Properties)
+	}
+
+	crd := &apiextensions.CustomResourceDefinition{}
+	crd.SetAnnotations(map[string]string{"helm.sh/resource-policy": "keep", "other": "x"})
+	KeepAnnotations("helm.sh/*")(crd)
+	if a := crd.GetAnnotations(); len(a) != 1 || a["helm.sh/resource-policy"] != "keep" {
+		t.Errorf("Expected only the helm annotation, got %v", a)
+	}
+
+	crd.Spec.Validation = &apiextensions.CustomResourceValidation{OpenAPIV3Schema: &apiextensions.JSONSchemaProps{
+		Description: "  A cluster.  \n\n\n\nWith details.\t\n",
+		Properties: map[string]apiextensions.JSONSchemaProps{
+			"status": {Type: "object"},
+			"spec":   {Type: "object", Description: "The spec. "},
+		},
+	}}
+	StripStatus()(crd)
+	NormalizeDescriptions()(crd)
+	s := crd.Spec.Validation.OpenAPIV3Schema
+	if _, ok := s.Properties["status"]; ok {
+		t.Errorf("Expected the status to be stripped")
+	}
+	if s.Description != "A cluster.\n\nWith details." || s.Properties["spec"].Description != "The spec." {
+		t.Errorf("Expected normalized descriptions, got %q and %q", s.Description, s.Properties["spec"].Description)
+	}
+}
+
+func TestDescriptionCoverage(t *testing.T) {
+	c, err := NewCRDer(v1servers)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	if cov := DescriptionCoverage(VersionSchema(c.CRD, "v1").OpenAPIV3Schema); cov != (Coverage{Properties: 5}) || cov.Percent() != 0 {
+		t.Errorf("Expected 5 undescribed properties, got %+v", cov)
+	}
+
+	s := &apiextensions.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensions.JSONSchemaProps{
+			"apiVersion": {Type: "string"},
+			"metadata":   {Type: "object", Properties: map[string]apiextensions.JSONSchemaProps{"name": {Type: "string"}}},
+			"spec": {
+				Type:        "object",
+				Description: "The spec.",
+				Properties: map[string]apiextensions.JSONSchemaProps{
+					"labels": {Type: "object", Description: "The labels.", AdditionalProperties: &apiextensions.JSONSchemaPropsOrBool{
+						Schema: &apiextensions.JSONSchemaProps{Type: "string"},
+					}},
+					"mode": {Type: "string", Description: " "},
+				},
+				AllOf: []apiextensions.JSONSchemaProps{{
+					Properties: map[string]apiextensions.JSONSchemaProps{"mode": {Description: "The mode."}},
+				}},
+			},
+		},
+	}
+	cov := DescriptionCoverage(s)
+	if cov != (Coverage{Properties: 3, Described: 2}) {
+		t.Errorf("Expected 2 of 3 properties described, got %+v", cov)
+	}
+	if p := cov.Add(Coverage{Properties: 1, Described: 1}).Percent(); p != 75 {
+		t.Errorf("Expected 75%% coverage, got %v", p)
+	}
+	if p := DescriptionCoverage(nil).Percent(); p != 100 {
+		t.Errorf("Expected full coverage without properties, got %v", p)
+	}
+}
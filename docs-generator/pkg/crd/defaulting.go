@@ -0,0 +1,157 @@
+package crd
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	structuralSchemaErr = "could not convert schema to structural schema"
+	defaultedComment    = "defaulted"
+)
+
+// DefaultResult is a CRD instance with the defaults of its schema applied.
+type DefaultResult struct {
+	// Object is the defaulted instance.
+	Object interface{}
+	// Defaulted are the paths of the fields which were filled in, e.g.
+	// spec.servers[0].port. Fields within a defaulted field are not listed.
+	Defaulted []string
+	// fields are the defaulted paths as segments, indices as numbers
+	fields [][]string
+}
+
+// Default applies the defaults of the schema of the version the instance
+// declares, like the apiserver does when reading or creating an object:
+// missing fields with a default are set, recursively.
+func (c *CRDer) Default(data []byte) (*DefaultResult, error) {
+	instance, v, err := c.parseInstance(data)
+	if err != nil {
+		return nil, err
+	}
+	res := &DefaultResult{Object: instance}
+	s, err := c.structuralSchema(v)
+	if err != nil || s == nil {
+		return res, err
+	}
+
+	before := runtime.DeepCopyJSONValue(instance)
+	structuraldefaulting.Default(instance, s)
+	var f fieldPaths
+	f.missing(instance, before, "", nil)
+	res.Defaulted, res.fields = f.paths, f.segments
+	return res, nil
+}
+
+// structuralSchema returns the schema of a version as structural schema, as
+// used by the apiserver for defaulting and pruning. It is nil if the version
+// has no schema.
+func (c *CRDer) structuralSchema(v apiextensions.CustomResourceDefinitionVersion) (*structuralschema.Structural, error) {
+	sv := VersionSchema(c.CRD, v.Name)
+	if sv == nil || sv.OpenAPIV3Schema == nil {
+		return nil, nil
+	}
+	s, err := structuralschema.NewStructural(sv.OpenAPIV3Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", structuralSchemaErr, err)
+	}
+	return s, nil
+}
+
+// fieldPaths are paths of fields, both as string and as segments.
+type fieldPaths struct {
+	paths    []string
+	segments [][]string
+}
+
+// missing records the fields of a which are missing in b, without
+// descending into them.
+func (f *fieldPaths) missing(a interface{}, b interface{}, path string, segments []string) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		bm, _ := b.(map[string]interface{})
+		keys := make([]string, 0, len(a))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			s := append(segments[:len(segments):len(segments)], k)
+			if bv, ok := bm[k]; ok {
+				f.missing(a[k], bv, p, s)
+			} else {
+				f.paths = append(f.paths, p)
+				f.segments = append(f.segments, s)
+			}
+		}
+	case []interface{}:
+		bl, _ := b.([]interface{})
+		for i := range a {
+			if i < len(bl) {
+				s := append(segments[:len(segments):len(segments)], strconv.Itoa(i))
+				f.missing(a[i], bl[i], fmt.Sprintf("%s[%d]", path, i), s)
+			}
+		}
+	}
+}
+
+// YAML returns the defaulted instance as YAML, with a comment marking each
+// defaulted field.
+func (r *DefaultResult) YAML() ([]byte, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(integers(r.Object)); err != nil {
+		return nil, err
+	}
+	for _, f := range r.fields {
+		if _, n, _, rest := walk(node, f); len(rest) == 0 {
+			n.LineComment = defaultedComment
+		}
+	}
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// integers converts whole numbers, which are float64 after decoding JSON, to
+// integers, so they are not written in exponent notation.
+func integers(x interface{}) interface{} {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			m[k] = integers(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, v := range x {
+			l[i] = integers(v)
+		}
+		return l
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return int64(x)
+		}
+	}
+	return x
+}
@@ -0,0 +1,197 @@
+// Package lint checks the schemas of CRDs for issues which make them hard to
+// use or to document, such as properties without description.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	crdutil "docs-generator/pkg/crd"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// Severity is how serious an issue is. Rules with severity Off are not
+// checked.
+type Severity string
+
+const (
+	Off     Severity = "off"
+	Info    Severity = "info"
+	Warning Severity = "warning"
+	Error   Severity = "error"
+)
+
+var severityRank = map[Severity]int{Off: 0, Info: 1, Warning: 2, Error: 3}
+
+// ParseSeverity parses the name of a severity.
+func ParseSeverity(s string) (Severity, error) {
+	if _, ok := severityRank[Severity(s)]; !ok {
+		return "", fmt.Errorf("unknown severity %q, expected off, info, warning or error", s)
+	}
+	return Severity(s), nil
+}
+
+// AtLeast returns true if s is as serious as t or more. Nothing is at least
+// Off.
+func (s Severity) AtLeast(t Severity) bool {
+	return t != Off && severityRank[s] >= severityRank[t]
+}
+
+// Issue is a problem found in a schema.
+type Issue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Path is the path of the schema as in crd.WalkSchema, e.g.
+	// spec.servers[*].port.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("[%s] %s %s: %s", i.Severity, i.Rule, displayPath(i.Path), i.Message)
+}
+
+// displayPath returns the path, or (root) for the path of the whole schema.
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// Rule checks a single schema, given its path. Problems are reported with
+// the path of the schema they concern.
+type Rule struct {
+	Name        string
+	Description string
+	// Severity is the default severity of the issues found by the rule.
+	Severity Severity
+	Check    func(path string, s *apiextensions.JSONSchemaProps, report func(path string, msg string))
+}
+
+// Linter checks schemas with a set of rules.
+type Linter struct {
+	rules []Rule
+}
+
+// New returns a linter with all rules, where the severities of the rules can
+// be overridden by rule name. Rules set to Off are not checked.
+func New(severities map[string]string) (*Linter, error) {
+	rules := Rules()
+	byName := map[string]int{}
+	for i, r := range rules {
+		byName[r.Name] = i
+	}
+	for name, s := range severities {
+		i, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown lint rule %s", name)
+		}
+		severity, err := ParseSeverity(s)
+		if err != nil {
+			return nil, fmt.Errorf("lint rule %s: %w", name, err)
+		}
+		rules[i].Severity = severity
+	}
+	l := &Linter{}
+	for _, r := range rules {
+		if r.Severity != Off {
+			l.rules = append(l.rules, r)
+		}
+	}
+	return l, nil
+}
+
+// Lint checks a schema and all schemas nested in it. The standard fields of
+// an object, apiVersion, kind and metadata, are not checked.
+func (l *Linter) Lint(schema *apiextensions.JSONSchemaProps) []Issue {
+	issues := []Issue{}
+	if schema == nil {
+		return issues
+	}
+	// schemas of allOf, anyOf, oneOf and not share the path of their parent,
+	// they are constraints rather than properties of their own
+	seen := map[string]bool{}
+	crdutil.WalkSchema(schema, func(path string, s *apiextensions.JSONSchemaProps) {
+		if seen[path] || isStandardField(path) {
+			return
+		}
+		seen[path] = true
+		for _, r := range l.rules {
+			r.Check(path, s, func(p string, msg string) {
+				issues = append(issues, Issue{Rule: r.Name, Severity: r.Severity, Path: p, Message: msg})
+			})
+		}
+	})
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Path < issues[j].Path
+	})
+	return issues
+}
+
+func isStandardField(path string) bool {
+	switch path {
+	case "apiVersion", "kind", "metadata":
+		return true
+	}
+	return strings.HasPrefix(path, "metadata.")
+}
+
+// Max returns the highest severity of the issues, Off if there are none.
+func Max(issues []Issue) Severity {
+	max := Off
+	for _, i := range issues {
+		if severityRank[i.Severity] > severityRank[max] {
+			max = i.Severity
+		}
+	}
+	return max
+}
+
+// Result are the issues of a single CRD version, e.g. example.com/Kind/v1,
+// optionally of a repo at a tag.
+type Result struct {
+	Repo   string  `json:"repo,omitempty"`
+	Tag    string  `json:"tag,omitempty"`
+	CRD    string  `json:"crd"`
+	Issues []Issue `json:"issues"`
+}
+
+func (r Result) subject() string {
+	if r.Repo == "" {
+		return r.CRD
+	}
+	return fmt.Sprintf("%s@%s %s", r.Repo, r.Tag, r.CRD)
+}
+
+// WriteText writes the issues, grouped by CRD.
+func WriteText(w io.Writer, results []Result) error {
+	for _, r := range results {
+		if len(r.Issues) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s:\n", r.subject()); err != nil {
+			return err
+		}
+		for _, i := range r.Issues {
+			if _, err := fmt.Fprintf(w, "  %-7s %-26s %s: %s\n", i.Severity, i.Rule, displayPath(i.Path), i.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the results as a JSON list.
+func WriteJSON(w io.Writer, results []Result) error {
+	if results == nil {
+		results = []Result{}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(results)
+}
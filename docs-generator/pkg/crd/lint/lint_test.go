@@ -0,0 +1,170 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	crdutil "docs-generator/pkg/crd"
+)
+
+var widgets = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    plural: widgets
+    singular: widget
+    kind: Widget
+  versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            metadata:
+              type: object
+            spec:
+              description: The desired state of the widget.
+              type: object
+              properties:
+                color:
+                  type: string
+                  enum: [red, green]
+                size_limit:
+                  description: The maximum size.
+                  type: integer
+                port:
+                  description: The port, a number or a name.
+                  x-kubernetes-int-or-string: true
+                extra:
+                  description: Anything.
+                servers:
+                  description: The servers.
+                  type: array
+                  items:
+                    type: object
+                    properties:
+                      name:
+                        description: The name of the server.
+                        type: string
+                ports:
+                  description: The ports.
+                  type: array
+                  x-kubernetes-list-type: map
+                  x-kubernetes-list-map-keys: [port, protocol]
+                  items:
+                    type: object
+                    required: [port]
+                    properties:
+                      port:
+                        description: The port.
+                        type: integer
+                      protocol:
+                        description: The protocol.
+                        type: string
+            status:
+              description: The observed state of the widget.
+              type: object
+              x-kubernetes-preserve-unknown-fields: true
+`)
+
+func lintWidgets(t *testing.T, severities map[string]string) []Issue {
+	c, err := crdutil.NewCRDer(widgets)
+	if err != nil {
+		t.Fatalf("Failed to parse CRD: %s", err)
+	}
+	l, err := New(severities)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %s", err)
+	}
+	return l.Lint(crdutil.VersionSchema(c.CRD, "v1").OpenAPIV3Schema)
+}
+
+func TestLint(t *testing.T) {
+	var found []string
+	for _, i := range lintWidgets(t, nil) {
+		found = append(found, i.String())
+	}
+	expected := []string{
+		"[warning] enum-without-description spec.color: enum of 2 values has no description",
+		"[warning] missing-type spec.extra: schema has no type",
+		"[warning] missing-required spec.ports[*].protocol: list map key is not required and has no default",
+		"[warning] missing-required spec.servers[*].name: name of list items is not required",
+		"[warning] camel-case spec.size_limit: property name \"size_limit\" is not lowerCamelCase",
+		"[warning] preserve-unknown-fields status: the status preserves unknown fields, typos are not pruned",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Unexpected issues:\n%s\nexpected:\n%s", strings.Join(found, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestLintSeverities(t *testing.T) {
+	issues := lintWidgets(t, map[string]string{"missing-required": "off", "camel-case": "error"})
+	for _, i := range issues {
+		if i.Rule == "missing-required" {
+			t.Errorf("Expected disabled rule not to be checked, got %s", i)
+		}
+	}
+	if m := Max(issues); m != Error {
+		t.Errorf("Expected the highest severity to be error, got %s", m)
+	}
+
+	if _, err := New(map[string]string{"no-such-rule": "error"}); err == nil {
+		t.Errorf("Expected an error for an unknown rule")
+	}
+	if _, err := New(map[string]string{"camel-case": "fatal"}); err == nil {
+		t.Errorf("Expected an error for an unknown severity")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	cases := []struct {
+		s, t     Severity
+		expected bool
+	}{
+		{Error, Warning, true},
+		{Warning, Warning, true},
+		{Info, Warning, false},
+		{Error, Off, false},
+	}
+	for _, tc := range cases {
+		if r := tc.s.AtLeast(tc.t); r != tc.expected {
+			t.Errorf("Expected %s at least %s to be %v", tc.s, tc.t, tc.expected)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	results := []Result{
+		{CRD: "example.com/Widget/v1", Issues: []Issue{{Rule: "missing-type", Severity: Warning, Path: "spec.extra", Message: "schema has no type"}}},
+		{CRD: "example.com/Gadget/v1", Issues: []Issue{}},
+	}
+	var b bytes.Buffer
+	if err := WriteText(&b, results); err != nil {
+		t.Fatalf("Failed to write text: %s", err)
+	}
+	if out := b.String(); !strings.HasPrefix(out, "example.com/Widget/v1:\n") || strings.Contains(out, "Gadget") {
+		t.Errorf("Unexpected text output:\n%s", out)
+	}
+
+	b.Reset()
+	if err := WriteJSON(&b, results); err != nil {
+		t.Fatalf("Failed to write JSON: %s", err)
+	}
+	var decoded []Result
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, results) {
+		t.Errorf("Unexpected JSON output: %s", b.String())
+	}
+}
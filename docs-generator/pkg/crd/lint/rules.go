@@ -0,0 +1,139 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+var camelCase = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// Rules returns all rules with their default severity.
+func Rules() []Rule {
+	return []Rule{
+		{
+			Name:        "missing-description",
+			Description: "properties should be described, the description is what the documentation shows",
+			Severity:    Info,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				// enums are reported by enum-without-description
+				if isProperty(path) && s.Description == "" && len(s.Enum) == 0 {
+					report(path, "property has no description")
+				}
+			},
+		},
+		{
+			Name:        "missing-type",
+			Description: "schemas should have a type, unless they are int-or-string or preserve unknown fields",
+			Severity:    Warning,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				if s.Type == "" && !s.XIntOrString && !preservesUnknownFields(s) {
+					report(path, "schema has no type")
+				}
+			},
+		},
+		{
+			Name:        "enum-without-description",
+			Description: "enums should describe what their values mean",
+			Severity:    Warning,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				if len(s.Enum) > 0 && s.Description == "" {
+					report(path, fmt.Sprintf("enum of %d values has no description", len(s.Enum)))
+				}
+			},
+		},
+		{
+			Name:        "camel-case",
+			Description: "property names should be lowerCamelCase, as in the Kubernetes API conventions",
+			Severity:    Warning,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				for _, name := range sortedKeys(s.Properties) {
+					if !camelCase.MatchString(name) {
+						report(child(path, name), fmt.Sprintf("property name %q is not lowerCamelCase", name))
+					}
+				}
+			},
+		},
+		{
+			Name:        "preserve-unknown-fields",
+			Description: "x-kubernetes-preserve-unknown-fields should not be set on the whole object, its spec or its status",
+			Severity:    Warning,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				if !preservesUnknownFields(s) {
+					return
+				}
+				switch path {
+				case "":
+					report(path, "the whole object preserves unknown fields, typos are not pruned")
+				case "spec", "status":
+					report(path, fmt.Sprintf("the %s preserves unknown fields, typos are not pruned", path))
+				}
+			},
+		},
+		{
+			Name:        "missing-required",
+			Description: "the keys of list maps and the name of list items should be required",
+			Severity:    Warning,
+			Check: func(path string, s *apiextensions.JSONSchemaProps, report func(string, string)) {
+				if s.Items == nil || s.Items.Schema == nil {
+					return
+				}
+				item := s.Items.Schema
+				listMap := s.XListType != nil && *s.XListType == "map"
+				keys := []string{"name"}
+				if listMap {
+					keys = s.XListMapKeys
+				}
+				for _, k := range keys {
+					p, ok := item.Properties[k]
+					if !ok || p.Default != nil || contains(item.Required, k) {
+						continue
+					}
+					if listMap {
+						report(child(path+"[*]", k), "list map key is not required and has no default")
+					} else {
+						report(child(path+"[*]", k), "name of list items is not required")
+					}
+				}
+			},
+		},
+	}
+}
+
+// isProperty returns true if the path is of a named property, not of the
+// root, array items or additional properties.
+func isProperty(path string) bool {
+	return path != "" && !strings.HasSuffix(path, "]") && path != "*" && !strings.HasSuffix(path, ".*")
+}
+
+func preservesUnknownFields(s *apiextensions.JSONSchemaProps) bool {
+	return s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields
+}
+
+func child(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(m map[string]apiextensions.JSONSchemaProps) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
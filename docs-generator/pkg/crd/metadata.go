@@ -0,0 +1,92 @@
+package crd
+
+import (
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// Metadata is what a CRD tells about a version of its resource apart from
+// the schema, e.g. whether it is namespaced and what `kubectl get` shows.
+type Metadata struct {
+	// Scope is either Namespaced or Cluster.
+	Scope          string          `json:"scope"`
+	Plural         string          `json:"plural"`
+	Singular       string          `json:"singular"`
+	ShortNames     []string        `json:"shortNames"`
+	Categories     []string        `json:"categories"`
+	PrinterColumns []PrinterColumn `json:"printerColumns"`
+	// Subresources are the names of the enabled subresources, status and
+	// scale.
+	Subresources []string `json:"subresources"`
+	Scale        *Scale   `json:"scale,omitempty"`
+}
+
+// PrinterColumn is an additional column shown by `kubectl get`.
+type PrinterColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Priority    int32  `json:"priority"`
+	JSONPath    string `json:"jsonPath"`
+}
+
+// Scale are the paths of the scale subresource.
+type Scale struct {
+	SpecReplicasPath   string `json:"specReplicasPath"`
+	StatusReplicasPath string `json:"statusReplicasPath"`
+	LabelSelectorPath  string `json:"labelSelectorPath,omitempty"`
+}
+
+// VersionMetadata returns the metadata of the named version of a CRD. Printer
+// columns and subresources which are the same for all versions are taken from
+// the top level.
+func VersionMetadata(crd *apiextensions.CustomResourceDefinition, name string) Metadata {
+	m := Metadata{
+		Scope:          string(crd.Spec.Scope),
+		Plural:         crd.Spec.Names.Plural,
+		Singular:       crd.Spec.Names.Singular,
+		ShortNames:     append([]string{}, crd.Spec.Names.ShortNames...),
+		Categories:     append([]string{}, crd.Spec.Names.Categories...),
+		PrinterColumns: []PrinterColumn{},
+		Subresources:   []string{},
+	}
+	columns := crd.Spec.AdditionalPrinterColumns
+	subresources := crd.Spec.Subresources
+	for _, v := range crd.Spec.Versions {
+		if v.Name != name {
+			continue
+		}
+		if len(v.AdditionalPrinterColumns) > 0 {
+			columns = v.AdditionalPrinterColumns
+		}
+		if v.Subresources != nil {
+			subresources = v.Subresources
+		}
+	}
+	for _, c := range columns {
+		m.PrinterColumns = append(m.PrinterColumns, PrinterColumn{
+			Name:        c.Name,
+			Type:        c.Type,
+			Format:      c.Format,
+			Description: c.Description,
+			Priority:    c.Priority,
+			JSONPath:    c.JSONPath,
+		})
+	}
+	if subresources != nil {
+		if subresources.Status != nil {
+			m.Subresources = append(m.Subresources, "status")
+		}
+		if s := subresources.Scale; s != nil {
+			m.Subresources = append(m.Subresources, "scale")
+			m.Scale = &Scale{
+				SpecReplicasPath:   s.SpecReplicasPath,
+				StatusReplicasPath: s.StatusReplicasPath,
+			}
+			if s.LabelSelectorPath != nil {
+				m.Scale.LabelSelectorPath = *s.LabelSelectorPath
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,151 @@
+package crd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// A ModifierFactory creates a Modifier from its arguments.
+type ModifierFactory func(args []string) (Modifier, error)
+
+// modifiers are the registered modifiers by name.
+var modifiers = map[string]ModifierFactory{
+	"stripLabels":           noArgs(StripLabels),
+	"stripAnnotations":      noArgs(StripAnnotations),
+	"stripConversion":       noArgs(StripConversion),
+	"stripStatus":           noArgs(StripStatus),
+	"normalizeDescriptions": noArgs(NormalizeDescriptions),
+	"keepAnnotations": func(args []string) (Modifier, error) {
+		for _, a := range args {
+			if _, err := path.Match(a, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", a, err)
+			}
+		}
+		return KeepAnnotations(args...), nil
+	},
+	"dropFields": func(args []string) (Modifier, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("no fields to drop given")
+		}
+		return DropFields(args...), nil
+	},
+}
+
+func noArgs(m func() Modifier) ModifierFactory {
+	return func(args []string) (Modifier, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("takes no arguments, got %v", args)
+		}
+		return m(), nil
+	}
+}
+
+// RegisterModifier makes a modifier available by name, replacing a modifier
+// of the same name. It is not safe to call concurrently with NewModifier.
+func RegisterModifier(name string, f ModifierFactory) {
+	modifiers[name] = f
+}
+
+// NewModifier returns the registered modifier of that name, created with the
+// arguments.
+func NewModifier(name string, args []string) (Modifier, error) {
+	f, ok := modifiers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown modifier %s, available are %s", name, strings.Join(ModifierNames(), ", "))
+	}
+	m, err := f(args)
+	if err != nil {
+		return nil, fmt.Errorf("modifier %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// ModifierNames returns the names of all registered modifiers, sorted.
+func ModifierNames() []string {
+	names := make([]string, 0, len(modifiers))
+	for name := range modifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeepAnnotations removes all annotations from a CRD's metadata except those
+// whose key matches any of the patterns, e.g. "helm.sh/*".
+func KeepAnnotations(patterns ...string) Modifier {
+	return func(crd *apiextensions.CustomResourceDefinition) {
+		kept := map[string]string{}
+		for k, v := range crd.GetAnnotations() {
+			for _, p := range patterns {
+				if ok, _ := path.Match(p, k); ok {
+					kept[k] = v
+					break
+				}
+			}
+		}
+		crd.SetAnnotations(kept)
+	}
+}
+
+// StripStatus removes the schema of the status from a CRD's schemas.
+func StripStatus() Modifier {
+	return DropFields("status")
+}
+
+// DropFields removes properties from a CRD's schemas, given by their path as
+// in WalkSchema, e.g. spec.servers[*].port.
+func DropFields(paths ...string) Modifier {
+	drop := map[string]bool{}
+	for _, p := range paths {
+		drop[p] = true
+	}
+	return func(crd *apiextensions.CustomResourceDefinition) {
+		walkCRDSchemas(crd, func(p string, s *apiextensions.JSONSchemaProps) {
+			for name := range s.Properties {
+				child := name
+				if p != "" {
+					child = p + "." + name
+				}
+				if !drop[child] {
+					continue
+				}
+				delete(s.Properties, name)
+				required := s.Required[:0]
+				for _, r := range s.Required {
+					if r != name {
+						required = append(required, r)
+					}
+				}
+				s.Required = required
+			}
+		})
+	}
+}
+
+// NormalizeDescriptions removes leading and trailing whitespace from the
+// descriptions of a CRD's schemas, and trailing whitespace and repeated
+// blank lines from their lines.
+func NormalizeDescriptions() Modifier {
+	return func(crd *apiextensions.CustomResourceDefinition) {
+		walkCRDSchemas(crd, func(_ string, s *apiextensions.JSONSchemaProps) {
+			s.Description = normalizeDescription(s.Description)
+		})
+	}
+}
+
+func normalizeDescription(d string) string {
+	lines := strings.Split(strings.TrimSpace(d), "\n")
+	normalized := lines[:0]
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		if l == "" && len(normalized) > 0 && normalized[len(normalized)-1] == "" {
+			continue
+		}
+		normalized = append(normalized, l)
+	}
+	return strings.Join(normalized, "\n")
+}
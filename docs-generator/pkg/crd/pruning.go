@@ -0,0 +1,36 @@
+package crd
+
+import (
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	structuralpruning "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PrunedFields returns the paths of the fields of a CRD instance which the
+// apiserver would drop, because the schema of the version the instance
+// declares does not define them. Fields below
+// x-kubernetes-preserve-unknown-fields are kept, and nothing is pruned if the
+// CRD preserves unknown fields altogether, like v1beta1 CRDs by default.
+func (c *CRDer) PrunedFields(data []byte) ([]string, error) {
+	instance, v, err := c.parseInstance(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.prunedFields(instance, v)
+}
+
+func (c *CRDer) prunedFields(instance interface{}, v apiextensions.CustomResourceDefinitionVersion) ([]string, error) {
+	if p := c.CRD.Spec.PreserveUnknownFields; p != nil && *p {
+		return nil, nil
+	}
+	s, err := c.structuralSchema(v)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	pruned := runtime.DeepCopyJSONValue(instance)
+	structuralpruning.Prune(pruned, s, true)
+	var f fieldPaths
+	f.missing(instance, pruned, "", nil)
+	return f.paths, nil
+}
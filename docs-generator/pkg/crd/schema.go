@@ -0,0 +1,79 @@
+package crd
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// WalkSchema calls f for a schema and every schema nested in it, parents
+// before children. Changes f makes to a schema are kept. The path of a
+// property is the path of its parent and its name, joined by a dot, e.g.
+// spec.servers[*].port, where [*] are the items of an array and .* the
+// additional properties of a map. Schemas of allOf, anyOf, oneOf and not
+// have the path of their parent. Definitions are not walked, as CRD schemas
+// must not have them.
+func WalkSchema(s *apiextensions.JSONSchemaProps, f func(path string, s *apiextensions.JSONSchemaProps)) {
+	walkSchema("", s, f)
+}
+
+// walkCRDSchemas calls WalkSchema for the top-level schema and the schemas of
+// all versions of a CRD.
+func walkCRDSchemas(crd *apiextensions.CustomResourceDefinition, f func(path string, s *apiextensions.JSONSchemaProps)) {
+	if v := crd.Spec.Validation; v != nil && v.OpenAPIV3Schema != nil {
+		WalkSchema(v.OpenAPIV3Schema, f)
+	}
+	for _, v := range crd.Spec.Versions {
+		if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			WalkSchema(v.Schema.OpenAPIV3Schema, f)
+		}
+	}
+}
+
+func walkSchema(path string, s *apiextensions.JSONSchemaProps, f func(string, *apiextensions.JSONSchemaProps)) {
+	f(path, s)
+	child := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	// properties are walked in a stable order
+	walkMap := func(m map[string]apiextensions.JSONSchemaProps) {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := m[name]
+			walkSchema(child(name), &p, f)
+			m[name] = p
+		}
+	}
+	walkMap(s.Properties)
+	walkMap(s.PatternProperties)
+	if s.Items != nil {
+		if s.Items.Schema != nil {
+			walkSchema(path+"[*]", s.Items.Schema, f)
+		}
+		for i := range s.Items.JSONSchemas {
+			walkSchema(fmt.Sprintf("%s[%d]", path, i), &s.Items.JSONSchemas[i], f)
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		walkSchema(child("*"), s.AdditionalProperties.Schema, f)
+	}
+	if s.AdditionalItems != nil && s.AdditionalItems.Schema != nil {
+		walkSchema(path+"[*]", s.AdditionalItems.Schema, f)
+	}
+	for _, l := range [][]apiextensions.JSONSchemaProps{s.AllOf, s.AnyOf, s.OneOf} {
+		for i := range l {
+			walkSchema(path, &l[i], f)
+		}
+	}
+	if s.Not != nil {
+		walkSchema(path, s.Not, f)
+	}
+}
@@ -0,0 +1,178 @@
+package crd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Violation is a field of an instance that does not match the schema.
+type Violation struct {
+	// Path is the path of the field, e.g. spec.servers[0].port.
+	Path string `json:"path"`
+	// Type is the kind of violation, e.g. FieldValueInvalid or
+	// FieldValueRequired.
+	Type string `json:"type"`
+	// Value is the offending value, if any.
+	Value  interface{} `json:"value,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+	// Line and Column locate the field in the YAML input, starting at 1. For
+	// missing fields they locate the closest parent found. They are 0 if the
+	// input could not be located.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+func (v Violation) String() string {
+	e := field.Error{Type: field.ErrorType(v.Type), Field: v.Path, BadValue: v.Value, Detail: v.Detail}
+	return e.Error()
+}
+
+// ValidationResult lists the violations of an instance. An instance without
+// violations is valid.
+type ValidationResult struct {
+	Violations []Violation `json:"violations"`
+	// Pruned are the paths of the fields the apiserver would drop, as they
+	// are unknown to the schema. They do not make the instance invalid.
+	Pruned []string `json:"pruned,omitempty"`
+	// Warnings are problems that do not make the instance invalid, e.g. the
+	// use of a deprecated version.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Valid returns true if there are no violations.
+func (r *ValidationResult) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// Err returns a *ValidationError if there are violations, and nil otherwise.
+func (r *ValidationResult) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return &ValidationError{Violations: r.Violations}
+}
+
+// ValidationError is returned by Validate for an instance with violations.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	errs := make(field.ErrorList, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		errs = append(errs, &field.Error{Type: field.ErrorType(v.Type), Field: v.Path, BadValue: v.Value, Detail: v.Detail})
+	}
+	return errs.ToAggregate().Error()
+}
+
+// newViolations converts the errors of the schema validator, locating the
+// fields in the YAML input where possible.
+func newViolations(errs field.ErrorList, data []byte) []Violation {
+	var root *yaml.Node
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err == nil && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	violations := make([]Violation, 0, len(errs))
+	for _, e := range errs {
+		v := Violation{Path: e.Field, Type: string(e.Type), Value: e.BadValue, Detail: e.Detail}
+		if root != nil {
+			var n, value *yaml.Node
+			v.Path, n, value = locate(root, strings.Split(e.Field, "."))
+			v.Line, v.Column = n.Line, n.Column
+			// for type mismatches the bad value is the expected type, the
+			// offending value is taken from the input instead
+			if value != nil && e.Type == field.ErrorTypeInvalid && strings.Contains(e.Detail, "must be of type") {
+				var bad interface{}
+				if err := value.Decode(&bad); err == nil {
+					v.Value = bad
+				}
+			}
+		}
+		violations = append(violations, v)
+	}
+	return violations
+}
+
+// locate follows a path as reported by the schema validator, where segments
+// are separated by dots, through a YAML document. It returns the path with
+// array indices in brackets, and the deepest node found. As keys may contain
+// dots, the longest matching key is used. If the whole path was found, the
+// node of its value is returned as well.
+func locate(root *yaml.Node, segments []string) (string, *yaml.Node, *yaml.Node) {
+	path, pos, value, rest := walk(root, segments)
+	for _, s := range rest {
+		if path != "" {
+			path += "."
+		}
+		path += s
+	}
+	if len(rest) > 0 {
+		value = nil
+	}
+	return path, pos, value
+}
+
+// walk follows the segments as far as possible and returns the node of the
+// last key or item found, its value and the segments it could not follow.
+// The schema validator omits the index of array items in nested paths, so an
+// array is only descended into if the segment is an index or if exactly one
+// item has the rest of the path.
+func walk(node *yaml.Node, segments []string) (string, *yaml.Node, *yaml.Node, []string) {
+	path, pos := "", node
+	join := func(p string) {
+		if path != "" && !strings.HasPrefix(p, "[") {
+			path += "."
+		}
+		path += p
+	}
+	for len(segments) > 0 {
+		found := false
+		switch node.Kind {
+		case yaml.MappingNode:
+			for n := len(segments); n > 0 && !found; n-- {
+				key := strings.Join(segments[:n], ".")
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == key {
+						join(key)
+						pos, node = node.Content[i], node.Content[i+1]
+						segments = segments[n:]
+						found = true
+						break
+					}
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(segments[0]); err == nil && i >= 0 && i < len(node.Content) {
+				join(fmt.Sprintf("[%d]", i))
+				pos, node = node.Content[i], node.Content[i]
+				segments = segments[1:]
+				found = true
+				break
+			}
+			match := -1
+			for i, item := range node.Content {
+				if _, _, _, rest := walk(item, segments); len(rest) == 0 {
+					if match >= 0 {
+						match = -1
+						break
+					}
+					match = i
+				}
+			}
+			if match >= 0 {
+				join(fmt.Sprintf("[%d]", match))
+				pos, node = node.Content[match], node.Content[match]
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return path, pos, node, segments
+}
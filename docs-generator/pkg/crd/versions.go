@@ -0,0 +1,86 @@
+package crd
+
+import (
+	"sort"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/yaml"
+)
+
+// Version is a version of a CRD which is documented, i.e. it is served or it
+// is the storage version.
+type Version struct {
+	Name               string
+	Served             bool
+	Storage            bool
+	Deprecated         bool
+	DeprecationWarning string
+}
+
+// deprecations holds the deprecation fields of the versions of a CRD. They
+// are not part of the vendored API types, so they are read from the document
+// itself.
+type deprecations struct {
+	Spec struct {
+		Versions []struct {
+			Name               string `json:"name"`
+			Deprecated         bool   `json:"deprecated"`
+			DeprecationWarning string `json:"deprecationWarning"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+func parseDeprecations(data []byte) map[string]string {
+	var d deprecations
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return nil
+	}
+	deprecated := map[string]string{}
+	for _, v := range d.Spec.Versions {
+		if v.Deprecated {
+			deprecated[v.Name] = v.DeprecationWarning
+		}
+	}
+	return deprecated
+}
+
+// Versions returns the served versions and the storage version of the CRD,
+// ordered by Kubernetes version priority, e.g. v2 before v1 before v1beta1.
+func (c *CRDer) Versions() []Version {
+	versions := []Version{}
+	for _, v := range c.CRD.Spec.Versions {
+		if !v.Served && !v.Storage {
+			continue
+		}
+		warning, deprecated := c.deprecated[v.Name]
+		versions = append(versions, Version{
+			Name:               v.Name,
+			Served:             v.Served,
+			Storage:            v.Storage,
+			Deprecated:         deprecated,
+			DeprecationWarning: warning,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return VersionLess(versions[j].Name, versions[i].Name)
+	})
+	return versions
+}
+
+// VersionLess orders versions by Kubernetes version priority, e.g. v1beta1
+// before v1 before v2.
+func VersionLess(a string, b string) bool {
+	return version.CompareKubeAwareVersionStrings(a, b) < 0
+}
+
+// VersionSchema returns the schema of the named version of a CRD. If the
+// versions share their schema, it is the top-level validation.
+func VersionSchema(crd *apiextensions.CustomResourceDefinition, name string) *apiextensions.CustomResourceValidation {
+	for _, v := range crd.Spec.Versions {
+		if v.Name == name && v.Schema != nil {
+			return v.Schema
+		}
+	}
+	return crd.Spec.Validation
+}
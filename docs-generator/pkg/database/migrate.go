@@ -0,0 +1,134 @@
+// Package database keeps databases created with an older version of
+// schema/crds_up.sql usable, so gitter can be re-run against them.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// column is a column added to a table of the schema after its first version.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// columns are the added columns in the order they were added. Columns which
+// are NOT NULL without default in the schema get an empty default here, as
+// existing rows need a value.
+var columns = []column{
+	{"tags", "source", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "sha", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "selector", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "branch", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "ordering", "INTEGER NOT NULL DEFAULT 0"},
+	{"tags", "author", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "tagger", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "tag_message", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "path", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "source_yaml", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "served", "BOOLEAN NOT NULL DEFAULT 1"},
+	{"crds", "storage", "BOOLEAN NOT NULL DEFAULT 1"},
+	{"crds", "deprecated", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"crds", "deprecation_warning", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "scope", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "short_names", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "categories", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "subresources", "TEXT NOT NULL DEFAULT ''"},
+	{"crds", "printer_columns", "TEXT NOT NULL DEFAULT '[]'"},
+	{"crds", "modifiers", "TEXT NOT NULL DEFAULT '[]'"},
+	{"crds", "properties", "INTEGER NOT NULL DEFAULT 0"},
+	{"crds", "described_properties", "INTEGER NOT NULL DEFAULT 0"},
+	{"crds", "description_coverage", "REAL NOT NULL DEFAULT 100"},
+}
+
+// tables are the tables added to the schema after its first version.
+var tables = []string{
+	`CREATE TABLE IF NOT EXISTS diagnostics (
+    tag_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    document INTEGER NOT NULL,
+    severity TEXT NOT NULL,
+    message TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+)`,
+	`CREATE TABLE IF NOT EXISTS examples (
+    tag_id INTEGER NOT NULL,
+    "group" TEXT NOT NULL,
+    version TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    document INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    valid BOOLEAN NOT NULL,
+    error TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+)`,
+	`CREATE TABLE IF NOT EXISTS lint_issues (
+    tag_id INTEGER NOT NULL,
+    "group" TEXT NOT NULL,
+    version TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    path TEXT NOT NULL,
+    message TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+)`,
+}
+
+// Migrate adds the tables and columns missing in a database, in a single
+// transaction. It does nothing for a database with the current schema. Tags
+// indexed before commits were recorded have an empty commit, so they are
+// indexed again.
+func Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	existing := map[string]map[string]bool{}
+	for _, table := range []string{"tags", "crds"} {
+		if existing[table], err = tableColumns(tx, table); err != nil {
+			return err
+		}
+		if len(existing[table]) == 0 {
+			return fmt.Errorf("table %s does not exist, initialize the database with schema/crds_up.sql", table)
+		}
+	}
+	for _, c := range columns {
+		if existing[c.table][c.name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition)); err != nil {
+			return fmt.Errorf("adding column %s.%s: %w", c.table, c.name, err)
+		}
+	}
+	for _, t := range tables {
+		if _, err := tx.Exec(t); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	c, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	names := map[string]bool{}
+	for c.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := c.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, c.Err()
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// firstSchema is the first version of schema/crds_up.sql.
+const firstSchema = `
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    repo TEXT NOT NULL,
+    time TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE(name, repo)
+);
+
+CREATE TABLE crds (
+    "group" TEXT NOT NULL,
+    version TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    tag_id INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    data TEXT NOT NULL,
+    PRIMARY KEY(tag_id, "group", version, kind),
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);`
+
+func openDB(t *testing.T, schema string) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	if schema != "" {
+		if _, err := db.Exec(schema); err != nil {
+			t.Fatalf("Failed to create schema: %s", err)
+		}
+	}
+	return db
+}
+
+// describe returns the names and types of the columns of each table.
+func describe(t *testing.T, db *sql.DB) map[string][]string {
+	tables := map[string][]string{}
+	for _, table := range []string{"tags", "crds", "diagnostics", "examples", "lint_issues"} {
+		c, err := db.Query("SELECT name, type FROM pragma_table_info($1) ORDER BY name", table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for c.Next() {
+			var name, typ string
+			if err := c.Scan(&name, &typ); err != nil {
+				t.Fatal(err)
+			}
+			tables[table] = append(tables[table], name+" "+typ)
+		}
+		c.Close()
+	}
+	return tables
+}
+
+func TestMigrate(t *testing.T) {
+	schema, err := os.ReadFile("../../../schema/crds_up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := describe(t, openDB(t, string(schema)))
+
+	db := openDB(t, firstSchema)
+	if _, err := db.Exec("INSERT INTO tags(name, repo) VALUES ('23.7.0', 'airflow-operator')"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("Failed to migrate (run %d): %s", i+1, err)
+		}
+	}
+	if migrated := describe(t, db); !reflect.DeepEqual(migrated, current) {
+		t.Errorf("Expected the migrated schema to match schema/crds_up.sql:\n%v\n%v", migrated, current)
+	}
+	var sha string
+	if err := db.QueryRow("SELECT sha FROM tags").Scan(&sha); err != nil || sha != "" {
+		t.Errorf("Expected existing tags to have no commit, got %q (%v)", sha, err)
+	}
+
+	if err := Migrate(openDB(t, "")); err == nil {
+		t.Errorf("Expected an error for an empty database")
+	}
+}
@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matcher finds files in a directory by include and exclude globs and
+// content patterns.
+type Matcher struct {
+	include []string
+	exclude []string
+	content []*regexp.Regexp
+}
+
+// NewMatcher returns a Matcher for the given globs and content patterns. Globs
+// are matched against slash separated paths relative to the searched
+// directory and support `**` for any number of directories. A file matches if
+// it matches any include glob, no exclude glob and any content pattern. Without
+// content patterns, all file contents match.
+func NewMatcher(include []string, exclude []string, content []string) (*Matcher, error) {
+	for _, g := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(g, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", g, err)
+		}
+	}
+	m := &Matcher{include: include, exclude: exclude}
+	for _, c := range content {
+		reg, err := regexp.Compile(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", c, err)
+		}
+		m.content = append(m.content, reg)
+	}
+	return m, nil
+}
+
+// MatchPath returns true if the path matches an include and no exclude glob.
+func (m *Matcher) MatchPath(p string) bool {
+	return matchAny(m.include, p) && !matchAny(m.exclude, p)
+}
+
+// MatchContent returns true if the content matches any content pattern.
+func (m *Matcher) MatchContent(b []byte) bool {
+	if len(m.content) == 0 {
+		return true
+	}
+	for _, reg := range m.content {
+		if reg.Match(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the sorted paths of all matching files in dir, relative and
+// slash separated.
+func (m *Matcher) Find(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !d.Type().IsRegular() || !m.MatchPath(rel) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if m.MatchContent(b) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func matchAny(globs []string, p string) bool {
+	for _, g := range globs {
+		if Match(g, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash separated path matches the glob. In
+// addition to the syntax of path.Match, a `**` segment matches any number of
+// directories.
+func Match(glob string, p string) bool {
+	return matchSegments(strings.Split(glob, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(glob []string, p []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(p); i++ {
+				if matchSegments(glob[1:], p[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(p) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], p[0]); !ok {
+			return false
+		}
+		glob, p = glob[1:], p[1:]
+	}
+	return len(p) == 0
+}
@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{glob: "deploy/helm/**/*.yaml", path: "deploy/helm/airflow-operator/crds/crds.yaml", matches: true},
+		{glob: "deploy/helm/**/*.yaml", path: "deploy/helm/crds.yaml", matches: true},
+		{glob: "deploy/helm/**/*.yaml", path: "deploy/helm/crds.yml", matches: false},
+		{glob: "deploy/helm/**/*.yaml", path: "deploy/crd/crds.yaml", matches: false},
+		{glob: "extra/crds.yaml", path: "extra/crds.yaml", matches: true},
+		{glob: "deploy/crd/*", path: "deploy/crd/a/crds.yaml", matches: false},
+		{glob: "**/*.json", path: "crds.json", matches: true},
+		{glob: "**/templates/**", path: "deploy/helm/op/templates/roles.yaml", matches: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.glob+" "+tc.path, func(t *testing.T) {
+			if m := Match(tc.glob, tc.path); m != tc.matches {
+				t.Errorf("Unexpected match result: %t", m)
+			}
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	m, err := NewMatcher([]string{"deploy/**/*.yaml"}, []string{"**/templates/**"}, []string{"kind: CustomResourceDefinition"})
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %s", err)
+	}
+	if !m.MatchPath("deploy/helm/op/crds/crds.yaml") {
+		t.Errorf("Expected included path to match")
+	}
+	if m.MatchPath("deploy/helm/op/templates/crds.yaml") {
+		t.Errorf("Expected excluded path not to match")
+	}
+	if !m.MatchContent([]byte("kind: CustomResourceDefinition")) || m.MatchContent([]byte("kind: Deployment")) {
+		t.Errorf("Unexpected content match")
+	}
+	if _, err := NewMatcher(nil, nil, []string{"("}); err == nil {
+		t.Errorf("Expected invalid pattern to fail")
+	}
+}
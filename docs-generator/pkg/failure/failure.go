@@ -0,0 +1,156 @@
+// Package failure classifies the errors of the commands, so that they can
+// exit with a distinct code for each kind of failure.
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Kind is the kind of a failure. Each kind has its own exit code.
+type Kind int
+
+const (
+	// Config is an invalid config file.
+	Config Kind = iota + 2
+	// Clone is a repo or reference which could not be fetched.
+	Clone
+	// Parse is a file or document which could not be parsed.
+	Parse
+	// Render is a page which could not be generated.
+	Render
+	// Database is a failed database query.
+	Database
+	// Lint is a CRD with lint issues at or above the configured severity.
+	Lint
+	// Coverage is a CRD whose description coverage is below the minimum.
+	Coverage
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Config:
+		return "config"
+	case Clone:
+		return "clone"
+	case Parse:
+		return "parse"
+	case Render:
+		return "render"
+	case Database:
+		return "database"
+	case Lint:
+		return "lint"
+	case Coverage:
+		return "coverage"
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+// ExitCode is the code a command exits with on a failure of this kind.
+func (k Kind) ExitCode() int {
+	return int(k)
+}
+
+// Error is a failure of a kind, concerning a subject such as a repo tag or
+// a page.
+type Error struct {
+	Kind    Kind
+	Subject string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Subject, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Collector aggregates failures, to report them at the end of a run. It is
+// not safe for concurrent use.
+type Collector struct {
+	Errors []*Error
+}
+
+// Wrap returns the error as a failure of the kind, or nil if err is nil.
+func Wrap(kind Kind, subject string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Subject: subject, Err: err}
+}
+
+// Add records a failure. If err already is a failure, its kind and subject
+// are kept. Nil errors are ignored.
+func (c *Collector) Add(kind Kind, subject string, err error) {
+	if err == nil {
+		return
+	}
+	var f *Error
+	if !errors.As(err, &f) {
+		f = &Error{Kind: kind, Subject: subject, Err: err}
+	}
+	c.Errors = append(c.Errors, f)
+}
+
+// ExitCode returns the exit code for the collected failures, 0 if there are
+// none. If there are failures of several kinds, the earliest kind in the
+// order config, clone, parse, render, database, lint, coverage wins, as it is the likely
+// cause of the others.
+func (c *Collector) ExitCode() int {
+	code := 0
+	for _, e := range c.Errors {
+		if code == 0 || e.Kind.ExitCode() < code {
+			code = e.Kind.ExitCode()
+		}
+	}
+	return code
+}
+
+// Summary writes the collected failures grouped by repo, in the order the
+// repos first failed, and by kind within each repo. The repo is the part of
+// the subject before the first "@" or space, e.g. "op" of "op@23.7.0".
+func (c *Collector) Summary(w io.Writer) {
+	if len(c.Errors) == 0 {
+		fmt.Fprintln(w, "Summary: no errors")
+		return
+	}
+	fmt.Fprintf(w, "Summary: %d error(s)\n", len(c.Errors))
+	var repos []string
+	byRepo := map[string][]*Error{}
+	for _, e := range c.Errors {
+		r := repo(e.Subject)
+		if _, ok := byRepo[r]; !ok {
+			repos = append(repos, r)
+		}
+		byRepo[r] = append(byRepo[r], e)
+	}
+	for _, r := range repos {
+		fmt.Fprintf(w, "  %s:\n", r)
+		for k := Config; k <= Coverage; k++ {
+			for _, e := range byRepo[r] {
+				if e.Kind == k {
+					fmt.Fprintf(w, "    [%s] %v\n", k, e)
+				}
+			}
+		}
+	}
+}
+
+func repo(subject string) string {
+	if i := strings.IndexAny(subject, "@ "); i > 0 {
+		return subject[:i]
+	}
+	return subject
+}
+
+// Exit prints the error and exits with the code of its kind.
+func Exit(kind Kind, err error) {
+	fmt.Fprintf(os.Stderr, "Error (%s): %v\n", kind, err)
+	os.Exit(kind.ExitCode())
+}
@@ -0,0 +1,66 @@
+package failure
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	var c Collector
+	if c.ExitCode() != 0 {
+		t.Errorf("Expected exit code 0 without errors, got %d", c.ExitCode())
+	}
+
+	c.Add(Render, "other@23.7.0 example.com/Widget/v1", errors.New("no schema"))
+	c.Add(Clone, "op@23.4.0", errors.New("not found"))
+	c.Add(Parse, "op@23.7.0", nil)
+	c.Add(Render, "op", Wrap(Database, "op tags", errors.New("locked")))
+	if len(c.Errors) != 3 {
+		t.Fatalf("Expected 3 errors, got %d", len(c.Errors))
+	}
+	if e := c.Errors[2]; e.Kind != Database || e.Subject != "op tags" {
+		t.Errorf("Expected the kind and subject of a wrapped failure to be kept, got %s %s", e.Kind, e.Subject)
+	}
+	if c.ExitCode() != Clone.ExitCode() {
+		t.Errorf("Expected the clone exit code %d, got %d", Clone.ExitCode(), c.ExitCode())
+	}
+
+	var b bytes.Buffer
+	c.Summary(&b)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := []string{
+		"Summary: 3 error(s)",
+		"  other:",
+		"    [render] other@23.7.0 example.com/Widget/v1: no schema",
+		"  op:",
+		"    [clone] op@23.4.0: not found",
+		"    [database] op tags: locked",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Unexpected summary:\n%s", b.String())
+	}
+}
+
+func TestExitCodesDistinct(t *testing.T) {
+	seen := map[int]Kind{}
+	for k := Config; k <= Coverage; k++ {
+		if k.ExitCode() <= 1 {
+			t.Errorf("Exit code of %s must not clash with 0 and 1", k)
+		}
+		if other, ok := seen[k.ExitCode()]; ok {
+			t.Errorf("%s and %s have the same exit code", k, other)
+		}
+		seen[k.ExitCode()] = k
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	cause := errors.New("cause")
+	var err error = &Error{Kind: Parse, Subject: "file", Err: cause}
+	if !errors.Is(err, cause) {
+		t.Errorf("Expected the error to wrap its cause")
+	}
+}
@@ -0,0 +1,88 @@
+package helm
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// FindCharts returns the directories below dir which contain a Helm chart,
+// relative and slash separated. Subcharts, in the charts directory of a
+// chart, are rendered as part of their parent chart and are not returned.
+func FindCharts(dir string) ([]string, error) {
+	var charts []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && d.Name() == "charts" {
+			if _, err := os.Stat(filepath.Join(filepath.Dir(p), chartutil.ChartfileName)); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		if d.IsDir() || d.Name() != chartutil.ChartfileName {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		charts = append(charts, filepath.ToSlash(rel))
+		return nil
+	})
+	return charts, err
+}
+
+// Render renders the templates of the chart in chartDir with the chart's
+// default values, overridden by the given values. The returned map is keyed by
+// the path of each template, relative to chartDir. Templates that render to
+// nothing are left out.
+func Render(chartDir string, values map[string]interface{}) (map[string][]byte, error) {
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		return nil, err
+	}
+	// the values come from our (yaml.v2) config, round trip them to get the
+	// map types helm expects
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := chartutil.ReadValues(b)
+	if err != nil {
+		return nil, err
+	}
+	opts := chartutil.ReleaseOptions{
+		Name:      ch.Name(),
+		Namespace: "default",
+		Revision:  1,
+		IsInstall: true,
+	}
+	renderVals, err := chartutil.ToRenderValues(ch, vals, opts, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	out, err := engine.Render(ch, renderVals)
+	if err != nil {
+		return nil, err
+	}
+	rendered := map[string][]byte{}
+	for name, content := range out {
+		if strings.TrimSpace(content) == "" || path.Base(name) == "NOTES.txt" {
+			continue
+		}
+		// names are prefixed with the chart name instead of its directory
+		rendered[strings.TrimPrefix(name, ch.Name()+"/")] = []byte(content)
+	}
+	return rendered, nil
+}
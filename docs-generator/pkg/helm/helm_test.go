@@ -0,0 +1,103 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var chartFiles = map[string]string{
+	"deploy/helm/op/Chart.yaml": `
+apiVersion: v2
+name: op
+version: 0.1.0
+`,
+	"deploy/helm/op/values.yaml": `
+crds:
+  install: true
+group: example.com
+`,
+	"deploy/helm/op/templates/_helpers.tpl": `
+{{- define "op.labels" -}}
+app: {{ .Release.Name }}
+{{- end }}
+`,
+	"deploy/helm/op/templates/crds.yaml": `
+{{- if .Values.crds.install }}
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.{{ .Values.group }}
+  labels:
+    {{- include "op.labels" . | nindent 4 }}
+{{- end }}
+`,
+}
+
+func writeChart(t *testing.T) string {
+	return writeFiles(t, chartFiles)
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRender(t *testing.T) {
+	dir := writeChart(t)
+	charts, err := FindCharts(dir)
+	if err != nil || len(charts) != 1 || charts[0] != "deploy/helm/op" {
+		t.Fatalf("Unexpected charts: %v (%v)", charts, err)
+	}
+
+	rendered, err := Render(filepath.Join(dir, charts[0]), nil)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	crds, ok := rendered["templates/crds.yaml"]
+	if !ok {
+		t.Fatalf("Expected rendered CRDs, got %v", rendered)
+	}
+	if !strings.Contains(string(crds), "name: widgets.example.com") || !strings.Contains(string(crds), "app: op") {
+		t.Errorf("Unexpected rendered CRDs: %s", crds)
+	}
+
+	rendered, err = Render(filepath.Join(dir, charts[0]), map[string]interface{}{
+		"crds": map[interface{}]interface{}{"install": false},
+	})
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if _, ok := rendered["templates/crds.yaml"]; ok {
+		t.Errorf("Expected configured values to disable the CRDs")
+	}
+}
+
+func TestFindCharts(t *testing.T) {
+	chart := "apiVersion: v2\nname: op\nversion: 0.1.0\n"
+	dir := writeFiles(t, map[string]string{
+		// the common layout of repos with several charts
+		"charts/op/Chart.yaml": chart,
+		// a subchart, rendered as part of its parent
+		"charts/op/charts/sub/Chart.yaml": chart,
+		"deploy/helm/op/Chart.yaml":       chart,
+	})
+	charts, err := FindCharts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"charts/op", "deploy/helm/op"}; !reflect.DeepEqual(charts, want) {
+		t.Errorf("Expected charts %v, got %v", want, charts)
+	}
+}
@@ -0,0 +1,33 @@
+package kustomize
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBinary is used if no kustomize binary is configured.
+const DefaultBinary = "kustomize"
+
+// Build runs a kustomize build of the kustomization in dir and returns the
+// resulting multi-document YAML. The binary is either kustomize itself or
+// kubectl, which embeds kustomize.
+func Build(binary string, dir string) ([]byte, error) {
+	if binary == "" {
+		binary = DefaultBinary
+	}
+	args := []string{"build", dir}
+	if strings.TrimSuffix(filepath.Base(binary), ".exe") == "kubectl" {
+		args = []string{"kustomize", dir}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w: %s", binary, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBinary writes a shell script of that name to a directory on the PATH.
+// It prints its arguments, or fails if the directory it builds is named
+// broken.
+func fakeBinary(t *testing.T, name string) {
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$2" in
+  */broken) echo "no kustomization found" >&2; exit 1 ;;
+esac
+echo "args: $*"
+`
+	if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestBuild(t *testing.T) {
+	fakeBinary(t, "kustomize")
+	fakeBinary(t, "kubectl")
+
+	cases := []struct {
+		binary string
+		args   string
+	}{
+		{binary: "", args: "build /repo/deploy"},
+		{binary: "kustomize", args: "build /repo/deploy"},
+		{binary: "kubectl", args: "kustomize /repo/deploy"},
+	}
+	for _, tc := range cases {
+		out, err := Build(tc.binary, "/repo/deploy")
+		if err != nil {
+			t.Errorf("Failed to build with %q: %s", tc.binary, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(out)); got != "args: "+tc.args {
+			t.Errorf("Unexpected arguments for %q: %s", tc.binary, got)
+		}
+	}
+
+	_, err := Build("kubectl", "/repo/broken")
+	if err == nil || !strings.Contains(err.Error(), "kubectl kustomize /repo/broken failed") || !strings.Contains(err.Error(), "no kustomization found") {
+		t.Errorf("Expected the failed command and its output in the error, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package manifest splits YAML files into their documents, keeping the
+// original text of each document.
+package manifest
+
+import (
+	"bytes"
+)
+
+// Document is a document of a YAML file.
+type Document struct {
+	// Line is the line of the file the document starts at, starting at 1.
+	Line int
+	// Data is the original text of the document.
+	Data []byte
+}
+
+// Split splits YAML text at the document separators, lines starting with
+// "---" (or the document end marker "..."). Documents without content, i.e.
+// only comments or whitespace, are dropped.
+func Split(file []byte) []Document {
+	var docs []Document
+	current := Document{Line: 1}
+	hasContent := false
+	line := 0
+	flush := func(next int) {
+		if hasContent {
+			if !bytes.HasSuffix(current.Data, []byte("\n")) {
+				current.Data = append(current.Data, '\n')
+			}
+			docs = append(docs, current)
+		}
+		current, hasContent = Document{Line: next}, false
+	}
+	for _, l := range bytes.SplitAfter(file, []byte("\n")) {
+		line++
+		if isSeparator(l) {
+			flush(line + 1)
+			continue
+		}
+		current.Data = append(current.Data, l...)
+		if t := bytes.TrimSpace(l); len(t) > 0 && t[0] != '#' {
+			hasContent = true
+		}
+	}
+	flush(line + 1)
+	return docs
+}
+
+func isSeparator(line []byte) bool {
+	for _, marker := range []string{"---", "..."} {
+		if rest, ok := bytes.CutPrefix(line, []byte(marker)); ok {
+			rest = bytes.TrimSpace(rest)
+			return len(rest) == 0 || rest[0] == '#'
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"testing"
+)
+
+var multiDoc = []byte(`# leading comment
+---
+# kept
+kind: A
+description: |
+  --- indented, not a separator
+---
+...
+--- # comment
+- a list
+---
+kind: B`)
+
+func TestSplit(t *testing.T) {
+	docs := Split(multiDoc)
+	want := []Document{
+		{Line: 3, Data: []byte("# kept\nkind: A\ndescription: |\n  --- indented, not a separator\n")},
+		{Line: 10, Data: []byte("- a list\n")},
+		{Line: 12, Data: []byte("kind: B\n")},
+	}
+	if len(docs) != len(want) {
+		t.Fatalf("Expected %d documents, got %d: %q", len(want), len(docs), docs)
+	}
+	for i := range want {
+		if docs[i].Line != want[i].Line || string(docs[i].Data) != string(want[i].Data) {
+			t.Errorf("Expected document %d to be %q at line %d, got %q at line %d", i, want[i].Data, want[i].Line, docs[i].Data, docs[i].Line)
+		}
+	}
+}
+
+func TestSplitSingle(t *testing.T) {
+	docs := Split([]byte("kind: A\n"))
+	if len(docs) != 1 || docs[0].Line != 1 || string(docs[0].Data) != "kind: A\n" {
+		t.Errorf("Unexpected documents: %q", docs)
+	}
+	if docs := Split([]byte("# nothing\n---\n")); len(docs) != 0 {
+		t.Errorf("Expected no documents, got %q", docs)
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found while indexing a tag, e.g. a document which
+// could not be parsed and was skipped.
+type Diagnostic struct {
+	// Path is the path of the file, relative to the repository root.
+	Path string `json:"path"`
+	// Document is the index of the document in the file, or -1 if the
+	// problem concerns the whole file.
+	Document int    `json:"document"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Example is an example custom resource found in a repository, with the
+// result of validating it against its CRD.
+type Example struct {
+	// Path is the path of the file, relative to the repository root.
+	Path string
+	// Document is the index of the document in the file.
+	Document int
+	Group    string
+	Version  string
+	Kind     string
+	Name     string
+	// Data is the document as it was found.
+	Data  []byte
+	Valid bool
+	// Error is the validation error of an invalid example.
+	Error string
+}
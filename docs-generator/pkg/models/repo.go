@@ -16,12 +16,35 @@ limitations under the License.
 
 package models
 
+import (
+	"docs-generator/pkg/crd"
+	"docs-generator/pkg/crd/lint"
+)
+
 // RepoCRD is a CRD and data about its location in a repository.
 type RepoCRD struct {
+	// Path is the path of the file the CRD was found in, relative to the
+	// repository root.
 	Path     string
 	Filename string
 	Group    string
 	Version  string
 	Kind     string
 	CRD      []byte
+	// SourceYAML is the document as it was found, before any modification.
+	SourceYAML []byte
+	// Served, Storage and Deprecated are the flags of the version.
+	Served             bool
+	Storage            bool
+	Deprecated         bool
+	DeprecationWarning string
+	Metadata           crd.Metadata
+	// Modifiers are the modifiers applied to the CRD, e.g.
+	// dropFields(status).
+	Modifiers []string
+	// Coverage is how many properties of the schema of the version are
+	// described.
+	Coverage crd.Coverage
+	// Lint are the issues the linter found in the schema of the version.
+	Lint []lint.Issue
 }
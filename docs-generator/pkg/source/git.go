@@ -0,0 +1,314 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+)
+
+// Git is a remote git repository. If a cache directory is set, a bare mirror
+// of the repository is kept there and all checkouts are made from the mirror.
+type Git struct {
+	URL      string
+	CacheDir string
+}
+
+var (
+	mirrorsMu sync.Mutex
+	mirrors   = map[string]*mirror{}
+)
+
+// mirror is a bare repository in the cache directory. It is fetched at most
+// once per run and guarded by a lock, as go-git repositories must not be used
+// concurrently.
+type mirror struct {
+	sync.Mutex
+	repo    *git.Repository
+	fetched bool
+}
+
+func (g *Git) String() string {
+	return g.URL
+}
+
+// Resolve returns the commit the reference points to. Annotated tags are
+// resolved to the commit they point to.
+func (g *Git) Resolve(ref plumbing.ReferenceName) (string, error) {
+	if g.CacheDir == "" {
+		return g.resolveRemote(ref)
+	}
+	m, err := g.mirror()
+	if err != nil {
+		return "", err
+	}
+	m.Lock()
+	defer m.Unlock()
+	c, _, err := resolveCommit(m.repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return c.Hash.String(), nil
+}
+
+// Tags lists the tags of the repository, from the mirror if a cache is used
+// and from the remote otherwise.
+func (g *Git) Tags() ([]string, error) {
+	var tags []string
+	if g.CacheDir == "" {
+		ar, err := g.advertisedReferences()
+		if err != nil {
+			return nil, err
+		}
+		for name := range ar.References {
+			if ref := plumbing.ReferenceName(name); ref.IsTag() {
+				tags = append(tags, ref.Short())
+			}
+		}
+		return tags, nil
+	}
+	m, err := g.mirror()
+	if err != nil {
+		return nil, err
+	}
+	m.Lock()
+	defer m.Unlock()
+	iter, err := m.repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	return tags, err
+}
+
+// Checkout clones the repository at the reference into a temporary directory.
+func (g *Git) Checkout(ref plumbing.ReferenceName) (*Checkout, error) {
+	dir, err := os.MkdirTemp(os.TempDir(), "doc-gitter")
+	if err != nil {
+		return nil, err
+	}
+	co := &Checkout{Dir: dir}
+	if g.CacheDir == "" {
+		err = g.clone(ref, co)
+	} else {
+		err = g.checkoutMirror(ref, co)
+	}
+	if err != nil {
+		co.Close()
+		return nil, err
+	}
+	return co, nil
+}
+
+func (g *Git) clone(ref plumbing.ReferenceName, co *Checkout) error {
+	cloneOpts := &git.CloneOptions{
+		URL:               g.URL,
+		Depth:             1,
+		Progress:          nil, // suppress progress output as it clogs up stdout otherwise
+		RecurseSubmodules: git.NoRecurseSubmodules,
+		ReferenceName:     ref,
+		SingleBranch:      true,
+	}
+	gitRepo, err := git.PlainClone(co.Dir, false, cloneOpts)
+	if err != nil {
+		return fmt.Errorf("failed to clone repo: %w", err)
+	}
+	c, t, err := resolveCommit(gitRepo, ref)
+	if err != nil {
+		return err
+	}
+	co.setProvenance(c, t)
+	return nil
+}
+
+// checkoutMirror writes the files of the commit the reference points to from
+// the mirror into the checkout directory.
+func (g *Git) checkoutMirror(ref plumbing.ReferenceName, co *Checkout) error {
+	m, err := g.mirror()
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	c, t, err := resolveCommit(m.repo, ref)
+	if err != nil {
+		return err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		// executable files are written with mode 0755, regular ones with 0644
+		perm := os.FileMode(0644)
+		switch f.Mode {
+		case filemode.Regular, filemode.Deprecated:
+		case filemode.Executable:
+			perm = 0755
+		default:
+			return nil // skip symlinks and submodules
+		}
+		p := filepath.Join(co.Dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		out, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, r)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	co.setProvenance(c, t)
+	return nil
+}
+
+// setProvenance records where the checkout comes from. The tag is nil unless
+// the reference is an annotated tag.
+func (co *Checkout) setProvenance(c *object.Commit, t *object.Tag) {
+	co.SHA = c.Hash.String()
+	co.Time = c.Committer.When
+	co.Author = c.Author.String()
+	if t != nil {
+		co.Tagger = t.Tagger.String()
+		co.TagMessage = strings.TrimSpace(t.Message)
+	}
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// mirror opens (or creates) the mirror of the repository and fetches it, if
+// that didn't happen yet during this run. If fetching fails, e.g. because we
+// are offline, the cached state is used.
+func (g *Git) mirror() (*mirror, error) {
+	path := filepath.Join(g.CacheDir, unsafeChars.ReplaceAllString(g.URL, "_")+".git")
+	mirrorsMu.Lock()
+	m, ok := mirrors[path]
+	if !ok {
+		m = &mirror{}
+		mirrors[path] = m
+	}
+	mirrorsMu.Unlock()
+
+	m.Lock()
+	defer m.Unlock()
+	if m.repo == nil {
+		repo, err := git.PlainOpen(path)
+		if err == git.ErrRepositoryNotExists {
+			repo, err = initMirror(path, g.URL)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cache %s: %w", path, err)
+		}
+		m.repo = repo
+	}
+	if !m.fetched {
+		err := m.repo.Fetch(&git.FetchOptions{
+			RemoteName: "origin",
+			Tags:       git.NoTags, // tags are covered by the refspecs
+			Progress:   nil,
+		})
+		switch err {
+		case nil:
+			log.Printf("Fetched %s into cache %s", g.URL, path)
+		case git.NoErrAlreadyUpToDate:
+		default:
+			log.Printf("WARNING: failed to fetch %s, using cached state: %v", g.URL, err)
+		}
+		m.fetched = true
+	}
+	return m, nil
+}
+
+func initMirror(path string, url string) (*git.Repository, error) {
+	repo, err := git.PlainInit(path, true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+		Fetch: []gitconfig.RefSpec{
+			"+refs/heads/*:refs/heads/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// resolveRemote returns the commit the reference points to in the remote
+// repository, without cloning it.
+func (g *Git) resolveRemote(ref plumbing.ReferenceName) (string, error) {
+	ar, err := g.advertisedReferences()
+	if err != nil {
+		return "", err
+	}
+	if h, ok := ar.Peeled[ref.String()]; ok {
+		return h.String(), nil
+	}
+	if h, ok := ar.References[ref.String()]; ok {
+		return h.String(), nil
+	}
+	return "", fmt.Errorf("reference %s not found", ref)
+}
+
+func (g *Git) advertisedReferences() (*packp.AdvRefs, error) {
+	ep, err := transport.NewEndpoint(g.URL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.NewUploadPackSession(ep, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.AdvertisedReferences()
+}
+
+// resolveCommit returns the commit the reference points to in a local
+// repository, peeling annotated tags. The tag object is returned as well if
+// the reference is an annotated tag.
+func resolveCommit(repo *git.Repository, ref plumbing.ReferenceName) (*object.Commit, *object.Tag, error) {
+	r, err := repo.Reference(ref, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to resolve reference %s: %w", ref, err)
+	}
+	if t, err := repo.TagObject(r.Hash()); err == nil {
+		c, err := t.Commit()
+		return c, t, err
+	}
+	c, err := repo.CommitObject(r.Hash())
+	return c, nil, err
+}
@@ -0,0 +1,77 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"docs-generator/internal/testutil"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// listFiles returns the content of each file in dir and whether it is
+// executable, ignoring the .git directory.
+func listFiles(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = fmt.Sprintf("%q executable=%v", b, fi.Mode()&0100 != 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGitCheckoutCached(t *testing.T) {
+	dir := t.TempDir()
+	testutil.CommitTag(t, dir, "1.0.0", map[string]string{
+		"deploy/crds.yaml":      "kind: CustomResourceDefinition\n",
+		"deploy/generated.yaml": "#!/bin/sh\n",
+	}, "deploy/generated.yaml")
+	ref := plumbing.NewTagReferenceName("1.0.0")
+
+	uncached := &Git{URL: "file://" + dir}
+	co, err := uncached.Checkout(ref)
+	if err != nil {
+		t.Fatalf("Failed to clone: %s", err)
+	}
+	defer co.Close()
+
+	cached := &Git{URL: "file://" + dir, CacheDir: t.TempDir()}
+	cco, err := cached.Checkout(ref)
+	if err != nil {
+		t.Fatalf("Failed to check out from the cache: %s", err)
+	}
+	defer cco.Close()
+
+	files, cachedFiles := listFiles(t, co.Dir), listFiles(t, cco.Dir)
+	if len(files) != 2 || !reflect.DeepEqual(files, cachedFiles) {
+		t.Errorf("Expected the same files with and without cache, got %v and %v", files, cachedFiles)
+	}
+	if co.SHA != cco.SHA {
+		t.Errorf("Expected the same commit, got %s and %s", co.SHA, cco.SHA)
+	}
+}
@@ -0,0 +1,181 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Local is a directory or a tar archive (optionally gzipped, like a packaged
+// Helm chart) on the local filesystem. It has no references, every reference
+// resolves to a hash of the names, sizes and modification times of its files.
+type Local struct {
+	Path string
+
+	mu sync.Mutex
+	// last is the state found by the last Resolve, reused by Checkout
+	last *localState
+}
+
+// localState identifies the content of a local source without reading it.
+type localState struct {
+	sha  string
+	time time.Time
+}
+
+func (l *Local) String() string {
+	return l.Path
+}
+
+// Resolve returns a hash of the names, sizes and modification times of the
+// files, so unchanged content is not indexed again.
+func (l *Local) Resolve(ref plumbing.ReferenceName) (string, error) {
+	s, err := l.stat()
+	if err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	l.last = s
+	l.mu.Unlock()
+	return s.sha, nil
+}
+
+// stat hashes the archive, or each regular file of the directory, by path,
+// size and modification time. The time is the latest modification time.
+func (l *Local) stat() (*localState, error) {
+	fi, err := os.Stat(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if !fi.IsDir() {
+		fmt.Fprintf(h, "%d %d\n", fi.Size(), fi.ModTime().UnixNano())
+		return &localState{sha: hex.EncodeToString(h.Sum(nil)), time: fi.ModTime()}, nil
+	}
+	var latest time.Time
+	err = filepath.WalkDir(l.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Path, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %d %d\n", filepath.ToSlash(rel), fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &localState{sha: hex.EncodeToString(h.Sum(nil)), time: latest}, nil
+}
+
+// Tags returns no tags, a local source only has the pseudo-tags it is
+// configured with.
+func (l *Local) Tags() ([]string, error) {
+	return nil, nil
+}
+
+// Checkout uses a directory as it is and extracts an archive into a temporary
+// directory. The time is the latest modification time of the content. The
+// hash found by the last Resolve is reused, so the files are not walked again.
+func (l *Local) Checkout(ref plumbing.ReferenceName) (*Checkout, error) {
+	l.mu.Lock()
+	s := l.last
+	l.mu.Unlock()
+	if s == nil {
+		var err error
+		if s, err = l.stat(); err != nil {
+			return nil, err
+		}
+	}
+	fi, err := os.Stat(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &Checkout{Dir: l.Path, SHA: s.sha, Time: s.time, keep: true}, nil
+	}
+	dir, err := os.MkdirTemp(os.TempDir(), "doc-gitter")
+	if err != nil {
+		return nil, err
+	}
+	co := &Checkout{Dir: dir, SHA: s.sha, Time: s.time}
+	if err := extract(l.Path, dir); err != nil {
+		co.Close()
+		return nil, fmt.Errorf("failed to extract %s: %w", l.Path, err)
+	}
+	return co, nil
+}
+
+// extract writes the regular files of a tar archive into dir.
+func extract(archive string, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(archive, ".tgz") || strings.HasSuffix(archive, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLocalArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "op-0.0.0-dev.tgz")
+	writeArchive(t, archive, map[string]string{
+		"op/Chart.yaml":     "name: op\n",
+		"op/crds/crds.yaml": "kind: CustomResourceDefinition\n",
+	})
+
+	l := &Local{Path: archive}
+	co, err := l.Checkout("")
+	if err != nil {
+		t.Fatalf("Failed to check out archive: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(co.Dir, "op", "crds", "crds.yaml"))
+	if err != nil || string(b) != "kind: CustomResourceDefinition\n" {
+		t.Errorf("Unexpected extracted content: %q (%v)", b, err)
+	}
+	if err := co.Close(); err != nil {
+		t.Errorf("Failed to close checkout: %s", err)
+	}
+	if _, err := os.Stat(co.Dir); !os.IsNotExist(err) {
+		t.Errorf("Expected extracted archive to be removed")
+	}
+}
+
+func TestLocalDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "crds.yaml"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Local{Path: dir}
+	before, err := l.Resolve("")
+	if err != nil {
+		t.Fatalf("Failed to resolve directory: %s", err)
+	}
+	co, err := l.Checkout("")
+	if err != nil || co.Dir != dir || co.SHA != before {
+		t.Fatalf("Unexpected checkout: %+v (%v)", co, err)
+	}
+	co.Close()
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected directory to be kept: %s", err)
+	}
+
+	// the modification time may not change for a quick write
+	p := filepath.Join(dir, "crds.yaml")
+	if err := os.WriteFile(p, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(p, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := l.Resolve(""); after == before {
+		t.Errorf("Expected changed content to change the hash")
+	}
+	co, err = l.Checkout("")
+	if err != nil || !co.Time.Equal(later) {
+		t.Errorf("Expected the latest modification time, got %+v (%v)", co, err)
+	}
+}
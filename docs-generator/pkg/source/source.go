@@ -0,0 +1,44 @@
+package source
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// A Source is a location CRDs are indexed from.
+type Source interface {
+	// Resolve returns the commit the reference points to, without checking
+	// it out.
+	Resolve(ref plumbing.ReferenceName) (string, error)
+	// Checkout makes the files at the reference available in a local
+	// directory. The checkout must be closed after use.
+	Checkout(ref plumbing.ReferenceName) (*Checkout, error)
+	// Tags lists the names of all tags of the source.
+	Tags() ([]string, error)
+	// String returns the location of the source, as recorded in the database.
+	String() string
+}
+
+// Checkout is a source checked out into a local directory.
+type Checkout struct {
+	Dir  string
+	SHA  string
+	Time time.Time
+	// Author of the commit, as "name <email>".
+	Author string
+	// Tagger and TagMessage are only set for annotated tags.
+	Tagger     string
+	TagMessage string
+	// keep is set if Dir is not a temporary copy and must not be removed
+	keep bool
+}
+
+// Close removes the checked out files.
+func (c *Checkout) Close() error {
+	if c.keep {
+		return nil
+	}
+	return os.RemoveAll(c.Dir)
+}
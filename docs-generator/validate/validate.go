@@ -0,0 +1,512 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	crdutil "docs-generator/pkg/crd"
+	"docs-generator/pkg/failure"
+	"docs-generator/pkg/manifest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// status is the outcome of validating a resource, as reported by kubeconform.
+type status string
+
+const (
+	statusValid   status = "statusValid"
+	statusInvalid status = "statusInvalid"
+	statusError   status = "statusError"
+	statusSkipped status = "statusSkipped"
+)
+
+// result is the validation result of a single document.
+type result struct {
+	File    string `json:"filename"`
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Status  status `json:"status"`
+	Msg     string `json:"msg"`
+	// Violations are the fields of an invalid resource which do not match
+	// the schema.
+	Violations []crdutil.Violation `json:"violations,omitempty"`
+	// Warnings do not make a resource invalid, e.g. a deprecated version.
+	Warnings []string `json:"warnings,omitempty"`
+	// Pruned are the fields the apiserver would drop.
+	Pruned []string `json:"pruned,omitempty"`
+	// defaulted is the resource with defaults applied, if requested.
+	defaulted []byte
+}
+
+type summary struct {
+	Resources int `json:"resources"`
+	Files     int `json:"files"`
+	Valid     int `json:"valid"`
+	Invalid   int `json:"invalid"`
+	Errors    int `json:"errors"`
+	Skipped   int `json:"skipped"`
+}
+
+// options control how resources are validated.
+type options struct {
+	// ignoreMissing skips resources without a CRD instead of failing.
+	ignoreMissing bool
+	// defaults applies the defaults of the schema to each resource.
+	defaults bool
+}
+
+// errMissingSchema is returned if no indexed CRD defines a resource.
+var errMissingSchema = errors.New("could not find schema")
+
+// schemas looks up the CRDs of a platform version or a repo tag in the
+// database. CRDs are looked up once per group and kind.
+type schemas struct {
+	db   *sql.DB
+	repo string
+	tag  string
+	// crds caches the CRDs, nil if there is none for the GVK
+	crds map[schema.GroupKind]*crdutil.CRDer
+}
+
+func main() {
+	var dbFile string
+	var platformVersion string
+	var repoTag string
+	var output string
+	var verbose bool
+	var opts options
+
+	flag.StringVar(&dbFile, "db", "", "Specify an SQLite3 database with the indexed CRDs")
+	flag.StringVar(&platformVersion, "version", "", "Validate against the CRDs of all repos at this platform version")
+	flag.StringVar(&repoTag, "repo-tag", "", "Validate against the CRDs of a single repo at a tag, given as repo@tag")
+	flag.StringVar(&output, "output", "text", "Output format: text, json, junit or defaults (the resources with the defaults of their schema applied)")
+	flag.BoolVar(&verbose, "verbose", false, "Also list valid and skipped resources in text output")
+	flag.BoolVar(&opts.ignoreMissing, "ignore-missing-schemas", false, "Skip resources without a CRD instead of failing")
+
+	flag.Parse()
+
+	// Check for mandatory flags
+	if dbFile == "" || (platformVersion == "") == (repoTag == "") || flag.NArg() == 0 {
+		fmt.Println("Error: db and either version or repo-tag flags are required, followed by files or directories to validate.")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	switch output {
+	case "text", "json", "junit":
+	case "defaults":
+		opts.defaults = true
+	default:
+		fmt.Printf("Error: unknown output format %s.\n", output)
+		os.Exit(1)
+	}
+
+	s := &schemas{tag: platformVersion, crds: map[schema.GroupKind]*crdutil.CRDer{}}
+	if repoTag != "" {
+		repo, tag, ok := strings.Cut(repoTag, "@")
+		if !ok || repo == "" || tag == "" {
+			fmt.Printf("Error: invalid repo-tag %s, expected repo@tag.\n", repoTag)
+			os.Exit(1)
+		}
+		s.repo, s.tag = repo, tag
+	}
+
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		failure.Exit(failure.Database, err)
+	}
+	defer db.Close()
+	s.db = db
+
+	files, err := findFiles(flag.Args())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var results []result
+	for _, file := range files {
+		r, err := s.validateFile(file, opts)
+		if err != nil {
+			failure.Exit(failure.Database, err)
+		}
+		results = append(results, r...)
+	}
+
+	sum := summarize(results, len(files))
+	switch output {
+	case "json":
+		err = writeJSON(os.Stdout, results, sum)
+	case "junit":
+		err = writeJUnit(os.Stdout, results, sum)
+	case "defaults":
+		err = writeDefaults(os.Stdout, results)
+		// the results go to stderr, to keep the output valid YAML
+		writeText(os.Stderr, results, sum, false)
+	default:
+		writeText(os.Stdout, results, sum, verbose)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if sum.Invalid > 0 || sum.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// findFiles returns the files given as arguments and the YAML and JSON files
+// below the directories given as arguments.
+func findFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".yaml", ".yml", ".json":
+				if d.Type().IsRegular() {
+					files = append(files, p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// validateFile validates all documents of a file. Only database errors are
+// returned, all other problems are part of the results.
+func (s *schemas) validateFile(file string, opts options) ([]result, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return []result{{File: file, Status: statusError, Msg: err.Error()}}, nil
+	}
+	var results []result
+	for _, d := range manifest.Split(b) {
+		r := result{File: file, Line: d.Line}
+		var meta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(d.Data, &meta); err != nil {
+			r.Status, r.Msg = statusError, fmt.Sprintf("failed to parse document: %v", err)
+			results = append(results, r)
+			continue
+		}
+		r.Kind, r.Name, r.Version = meta.Kind, meta.Metadata.Name, meta.APIVersion
+		if meta.Kind == "" || meta.APIVersion == "" {
+			r.Status, r.Msg = statusError, "missing apiVersion or kind"
+			results = append(results, r)
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(meta.APIVersion)
+		if err != nil {
+			r.Status, r.Msg = statusError, err.Error()
+			results = append(results, r)
+			continue
+		}
+		crder, err := s.lookup(gv.WithKind(meta.Kind).GroupKind())
+		switch {
+		case errors.Is(err, errMissingSchema) && opts.ignoreMissing:
+			r.Status = statusSkipped
+		case errors.Is(err, errMissingSchema):
+			r.Status, r.Msg = statusError, fmt.Sprintf("%v for %s", err, meta.Kind)
+		case err != nil:
+			return nil, err
+		default:
+			res, err := crder.ValidateDetailed(d.Data)
+			switch {
+			case err != nil:
+				r.Status, r.Msg = statusError, err.Error()
+			case !res.Valid():
+				r.Status, r.Msg = statusInvalid, res.Err().Error()
+				// lines are relative to the document
+				for _, v := range res.Violations {
+					if v.Line > 0 {
+						v.Line += d.Line - 1
+					}
+					r.Violations = append(r.Violations, v)
+				}
+			default:
+				r.Status = statusValid
+			}
+			if res != nil {
+				r.Warnings, r.Pruned = res.Warnings, res.Pruned
+			}
+			if res != nil && opts.defaults {
+				if r.defaulted, err = defaulted(crder, d.Data); err != nil {
+					r.Warnings = append(r.Warnings, fmt.Sprintf("failed to apply defaults: %v", err))
+				}
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// lookup returns the CRD defining the group and kind, or errMissingSchema if
+// there is none. The CRD decides whether the version is served.
+func (s *schemas) lookup(gk schema.GroupKind) (*crdutil.CRDer, error) {
+	crder, ok := s.crds[gk]
+	if !ok {
+		var err error
+		crder, err = s.fetch(gk)
+		if err != nil {
+			return nil, err
+		}
+		s.crds[gk] = crder
+	}
+	if crder == nil {
+		return nil, errMissingSchema
+	}
+	return crder, nil
+}
+
+func (s *schemas) fetch(gk schema.GroupKind) (*crdutil.CRDer, error) {
+	var r *sql.Row
+	if s.repo == "" {
+		r = s.db.QueryRow("SELECT c.tag_id, c.data FROM crds c INNER JOIN tags t ON (c.tag_id = t.id) WHERE t.name=$1 AND c.\"group\"=$2 AND c.kind=$3 ORDER BY t.repo LIMIT 1;", s.tag, gk.Group, gk.Kind)
+	} else {
+		r = s.db.QueryRow("SELECT c.tag_id, c.data FROM crds c INNER JOIN tags t ON (c.tag_id = t.id) WHERE LOWER(t.repo)=LOWER($1) AND t.name=$2 AND c.\"group\"=$3 AND c.kind=$4 LIMIT 1;", s.repo, s.tag, gk.Group, gk.Kind)
+	}
+	var tagID int
+	var crdJSON string
+	err := r.Scan(&tagID, &crdJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRD %s: %w", gk, err)
+	}
+	crd := &apiextensions.CustomResourceDefinition{}
+	if err := json.Unmarshal([]byte(crdJSON), crd); err != nil {
+		return nil, fmt.Errorf("error unmarshalling CRD %s: %w", gk, err)
+	}
+	crder, err := crdutil.NewCRDerFromInternal(crd)
+	if err != nil {
+		return nil, err
+	}
+
+	// the deprecation of the versions is only stored in the rows
+	c, err := s.db.Query("SELECT version, deprecation_warning FROM crds WHERE tag_id=$1 AND \"group\"=$2 AND kind=$3 AND deprecated;", tagID, gk.Group, gk.Kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions of CRD %s: %w", gk, err)
+	}
+	defer c.Close()
+	for c.Next() {
+		var version, warning string
+		if err := c.Scan(&version, &warning); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		crder.SetDeprecated(version, warning)
+	}
+	return crder, c.Err()
+}
+
+func summarize(results []result, files int) summary {
+	sum := summary{Resources: len(results), Files: files}
+	for _, r := range results {
+		switch r.Status {
+		case statusValid:
+			sum.Valid++
+		case statusInvalid:
+			sum.Invalid++
+		case statusError:
+			sum.Errors++
+		case statusSkipped:
+			sum.Skipped++
+		}
+	}
+	return sum
+}
+
+func writeText(w io.Writer, results []result, sum summary, verbose bool) {
+	for _, r := range results {
+		subject := fmt.Sprintf("%s:%d", r.File, r.Line)
+		if r.Kind != "" {
+			subject += fmt.Sprintf(" - %s %s", r.Kind, r.Name)
+		}
+		for _, warning := range r.Warnings {
+			fmt.Fprintf(w, "%s has a warning: %s\n", subject, warning)
+		}
+		for _, p := range r.Pruned {
+			fmt.Fprintf(w, "%s has a warning: %s would be pruned, it is unknown to the schema\n", subject, p)
+		}
+		switch r.Status {
+		case statusInvalid:
+			if len(r.Violations) == 0 {
+				fmt.Fprintf(w, "%s is invalid: %s\n", subject, r.Msg)
+			}
+			for _, v := range r.Violations {
+				fmt.Fprintf(w, "%s is invalid: %s\n", violationSubject(r, v), v)
+			}
+		case statusError:
+			fmt.Fprintf(w, "%s failed validation: %s\n", subject, r.Msg)
+		case statusValid:
+			if verbose {
+				fmt.Fprintf(w, "%s is valid\n", subject)
+			}
+		case statusSkipped:
+			if verbose {
+				fmt.Fprintf(w, "%s skipped\n", subject)
+			}
+		}
+	}
+	fmt.Fprintf(w, "Summary: %d resource(s) found in %d file(s) - Valid: %d, Invalid: %d, Errors: %d, Skipped: %d\n",
+		sum.Resources, sum.Files, sum.Valid, sum.Invalid, sum.Errors, sum.Skipped)
+}
+
+// defaulted returns the resource with the defaults of its schema applied as
+// YAML, where defaulted fields are marked by a comment.
+func defaulted(crder *crdutil.CRDer, data []byte) ([]byte, error) {
+	res, err := crder.Default(data)
+	if err != nil {
+		return nil, err
+	}
+	return res.YAML()
+}
+
+// writeDefaults writes the defaulted resources as a YAML stream, each
+// preceded by a comment naming its location.
+func writeDefaults(w io.Writer, results []result) error {
+	for _, r := range results {
+		if r.defaulted == nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "---\n# %s:%d\n%s", r.File, r.Line, r.defaulted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// violationSubject locates a violation by line and column, if known, or by
+// the resource.
+func violationSubject(r result, v crdutil.Violation) string {
+	if v.Line == 0 {
+		return fmt.Sprintf("%s:%d - %s %s", r.File, r.Line, r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s:%d:%d - %s %s", r.File, v.Line, v.Column, r.Kind, r.Name)
+}
+
+func writeJSON(w io.Writer, results []result, sum summary) error {
+	if results == nil {
+		results = []result{}
+	}
+	out := struct {
+		Resources []result `json:"resources"`
+		Summary   summary  `json:"summary"`
+	}{results, sum}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(out)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes a test suite per file and a test case per resource.
+func writeJUnit(w io.Writer, results []result, sum summary) error {
+	out := junitTestSuites{
+		Name:     "validate",
+		Tests:    sum.Resources,
+		Failures: sum.Invalid,
+		Errors:   sum.Errors,
+		Skipped:  sum.Skipped,
+	}
+	suites := map[string]int{}
+	for _, r := range results {
+		i, ok := suites[r.File]
+		if !ok {
+			i = len(out.Suites)
+			suites[r.File] = i
+			out.Suites = append(out.Suites, junitTestSuite{Name: r.File})
+		}
+		suite := &out.Suites[i]
+		c := junitTestCase{
+			Name:      fmt.Sprintf("%s %s (line %d)", r.Kind, r.Name, r.Line),
+			ClassName: r.Version + "/" + r.Kind,
+		}
+		suite.Tests++
+		switch r.Status {
+		case statusInvalid:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: r.Msg}
+		case statusError:
+			suite.Errors++
+			c.Error = &junitMessage{Message: r.Msg}
+		case statusSkipped:
+			suite.Skipped++
+			c.Skipped = &junitMessage{}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
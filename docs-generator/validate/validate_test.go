@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	crdutil "docs-generator/pkg/crd"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var widgetCRD = []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              color:
+                type: string
+                default: blue
+`)
+
+var manifests = []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: good
+spec:
+  size: 1
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: bad
+spec:
+  size: large
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unknown
+---
+metadata:
+  name: no-kind
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: typo
+spec:
+  sise: 1
+`)
+
+func TestValidateFile(t *testing.T) {
+	crder, err := crdutil.NewCRDer(widgetCRD)
+	if err != nil {
+		t.Fatalf("Failed to create CRDer: %s", err)
+	}
+	// the CRDs are cached, so no database is needed
+	s := &schemas{crds: map[schema.GroupKind]*crdutil.CRDer{
+		crder.GVK.GroupKind(): crder,
+		{Kind: "ConfigMap"}:   nil,
+	}}
+	file := filepath.Join(t.TempDir(), "widgets.yaml")
+	if err := os.WriteFile(file, manifests, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.validateFile(file, options{})
+	if err != nil {
+		t.Fatalf("Failed to validate: %s", err)
+	}
+	expected := []struct {
+		name   string
+		line   int
+		status status
+	}{
+		{"good", 1, statusValid},
+		{"bad", 8, statusInvalid},
+		{"unknown", 15, statusError},
+		{"no-kind", 20, statusError},
+		{"typo", 23, statusValid},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i, e := range expected {
+		r := results[i]
+		if r.Name != e.name || r.Line != e.line || r.Status != e.status {
+			t.Errorf("Expected %s at line %d to be %s, got %+v", e.name, e.line, e.status, r)
+		}
+	}
+	if v := results[1].Violations; len(v) != 1 || v[0].Path != "spec.size" || v[0].Line != 13 {
+		t.Errorf("Expected a violation of spec.size at line 13, got %+v", v)
+	}
+	// pruned fields are only listed once, the text output warns about them
+	if p := results[4].Pruned; len(p) != 1 || p[0] != "spec.sise" || len(results[4].Warnings) != 0 {
+		t.Errorf("Expected the pruned spec.sise, got %+v", results[4])
+	}
+	var text bytes.Buffer
+	writeText(&text, results[4:5], summary{}, false)
+	if !strings.Contains(text.String(), "has a warning: spec.sise would be pruned") {
+		t.Errorf("Expected a warning for the pruned spec.sise, got %s", text.String())
+	}
+	sum := summarize(results, 1)
+	if sum.Valid != 2 || sum.Invalid != 1 || sum.Errors != 2 {
+		t.Errorf("Unexpected summary %+v", sum)
+	}
+
+	results, err = s.validateFile(file, options{ignoreMissing: true})
+	if err != nil {
+		t.Fatalf("Failed to validate: %s", err)
+	}
+	if results[2].Status != statusSkipped {
+		t.Errorf("Expected a resource without CRD to be skipped, got %+v", results[2])
+	}
+
+	results, err = s.validateFile(file, options{defaults: true})
+	if err != nil {
+		t.Fatalf("Failed to validate: %s", err)
+	}
+	if !strings.Contains(string(results[0].defaulted), "color: blue # defaulted") {
+		t.Errorf("Expected the defaulted color, got:\n%s", results[0].defaulted)
+	}
+	if results[2].defaulted != nil {
+		t.Errorf("Expected no defaults for a resource without CRD")
+	}
+}
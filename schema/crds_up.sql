@@ -2,6 +2,14 @@ CREATE TABLE tags (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     name TEXT NOT NULL,
     repo TEXT NOT NULL,
+    source TEXT NOT NULL,
+    sha TEXT NOT NULL,
+    selector TEXT NOT NULL,
+    branch TEXT NOT NULL DEFAULT '',
+    ordering INTEGER NOT NULL DEFAULT 0,
+    author TEXT NOT NULL DEFAULT '',
+    tagger TEXT NOT NULL DEFAULT '',
+    tag_message TEXT NOT NULL DEFAULT '',
     time TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
     UNIQUE(name, repo)
 );
@@ -12,7 +20,57 @@ CREATE TABLE crds (
     kind TEXT NOT NULL,
     tag_id INTEGER NOT NULL,
     filename TEXT NOT NULL,
+    path TEXT NOT NULL,
     data TEXT NOT NULL,
+    source_yaml TEXT NOT NULL DEFAULT '',
+    served BOOLEAN NOT NULL DEFAULT 1,
+    storage BOOLEAN NOT NULL DEFAULT 1,
+    deprecated BOOLEAN NOT NULL DEFAULT 0,
+    deprecation_warning TEXT NOT NULL DEFAULT '',
+    scope TEXT NOT NULL DEFAULT '',
+    short_names TEXT NOT NULL DEFAULT '',
+    categories TEXT NOT NULL DEFAULT '',
+    subresources TEXT NOT NULL DEFAULT '',
+    printer_columns TEXT NOT NULL DEFAULT '[]',
+    modifiers TEXT NOT NULL DEFAULT '[]',
+    properties INTEGER NOT NULL DEFAULT 0,
+    described_properties INTEGER NOT NULL DEFAULT 0,
+    description_coverage REAL NOT NULL DEFAULT 100,
     PRIMARY KEY(tag_id, "group", version, kind),
     FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+CREATE TABLE diagnostics (
+    tag_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    document INTEGER NOT NULL,
+    severity TEXT NOT NULL,
+    message TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE examples (
+    tag_id INTEGER NOT NULL,
+    "group" TEXT NOT NULL,
+    version TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    document INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    valid BOOLEAN NOT NULL,
+    error TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE TABLE lint_issues (
+    tag_id INTEGER NOT NULL,
+    "group" TEXT NOT NULL,
+    version TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    path TEXT NOT NULL,
+    message TEXT NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);